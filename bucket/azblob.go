@@ -0,0 +1,164 @@
+package bucket
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+)
+
+type AzureBlob struct {
+	container string
+	client    *azblob.Client
+}
+
+// NewAzureBlob connects to an Azure Blob Storage container. Credentials are
+// picked in order: the AZURE_STORAGE_CONNECTION_STRING environment variable,
+// a shared key (--keyId account name, --secretKey account key), then the
+// default Azure credential chain. --endpoint overrides the service URL,
+// e.g. http://127.0.0.1:10000/devstoreaccount1 for Azurite.
+func NewAzureBlob(ctx context.Context, container string, cfg Config) (*AzureBlob, error) {
+	opts := clientOptions()
+	if connStr := os.Getenv("AZURE_STORAGE_CONNECTION_STRING"); connStr != "" {
+		client, err := azblob.NewClientFromConnectionString(connStr, opts)
+		if err != nil {
+			return nil, err
+		}
+		return &AzureBlob{container: container, client: client}, nil
+	}
+
+	serviceURL := cfg.Endpoint
+	if serviceURL == "" {
+		if cfg.KeyId == "" {
+			return nil, errors.New("--endpoint or --keyId (storage account name) is required")
+		}
+		serviceURL = fmt.Sprintf("https://%s.blob.core.windows.net/", cfg.KeyId)
+	}
+
+	var client *azblob.Client
+	if cfg.KeyId != "" && cfg.SecretKey != "" {
+		cred, err := azblob.NewSharedKeyCredential(cfg.KeyId, cfg.SecretKey)
+		if err != nil {
+			return nil, err
+		}
+		client, err = azblob.NewClientWithSharedKeyCredential(serviceURL, cred, opts)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		cred, err := azidentity.NewDefaultAzureCredential(nil)
+		if err != nil {
+			return nil, err
+		}
+		client, err = azblob.NewClient(serviceURL, cred, opts)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &AzureBlob{container: container, client: client}, nil
+}
+
+// clientOptions turns off the transparent gunzip of Go's transport, so
+// blobs stored with Content-Encoding: gzip download as stored, like
+// ReadCompressed on gs://.
+func clientOptions() *azblob.ClientOptions {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DisableCompression = true
+	return &azblob.ClientOptions{
+		ClientOptions: azcore.ClientOptions{Transport: &http.Client{Transport: transport}},
+	}
+}
+
+func (b *AzureBlob) Name() string {
+	return "azblob://" + b.container
+}
+
+func (b *AzureBlob) Upload(ctx context.Context, key string, body []byte, opts UploadOptions) error {
+	meta := make(map[string]*string, len(opts.Metadata))
+	for k, v := range opts.Metadata {
+		meta[k] = &v
+	}
+	uploadOpts := &azblob.UploadBufferOptions{
+		Metadata: meta,
+	}
+	if opts.ContentEncoding != "" {
+		uploadOpts.HTTPHeaders = &blob.HTTPHeaders{BlobContentEncoding: &opts.ContentEncoding}
+	}
+	_, err := b.client.UploadBuffer(ctx, b.container, key, body, uploadOpts)
+	return err
+}
+
+func (b *AzureBlob) List(ctx context.Context, prefix string) ([]Object, error) {
+	pager := b.client.NewListBlobsFlatPager(b.container, &azblob.ListBlobsFlatOptions{
+		Prefix:  &prefix,
+		Include: azblob.ListBlobsInclude{Metadata: true},
+	})
+
+	var objects []Object
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range page.Segment.BlobItems {
+			obj := Object{Key: *item.Name, Metadata: map[string]string{}}
+			for k, v := range item.Metadata {
+				if v != nil {
+					obj.Metadata[strings.ToLower(k)] = *v
+				}
+			}
+			if props := item.Properties; props != nil {
+				if props.ContentLength != nil {
+					obj.Size = *props.ContentLength
+				}
+				if props.LastModified != nil {
+					obj.LastModified = *props.LastModified
+				}
+				if props.ETag != nil {
+					obj.ETag = strings.Trim(string(*props.ETag), `"`)
+					obj.Version = string(*props.ETag)
+				}
+			}
+			objects = append(objects, obj)
+		}
+	}
+	return objects, nil
+}
+
+func (b *AzureBlob) Download(ctx context.Context, key string) ([]byte, error) {
+	resp, err := b.client.DownloadStream(ctx, b.container, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	return io.ReadAll(resp.Body)
+}
+
+func (b *AzureBlob) DownloadRange(ctx context.Context, key, version string, offset, length int64) ([]byte, error) {
+	opts := &azblob.DownloadStreamOptions{
+		Range: azblob.HTTPRange{Offset: offset, Count: length},
+	}
+	if version != "" {
+		etag := azcore.ETag(version)
+		opts.AccessConditions = &blob.AccessConditions{
+			ModifiedAccessConditions: &blob.ModifiedAccessConditions{IfMatch: &etag},
+		}
+	}
+	resp, err := b.client.DownloadStream(ctx, b.container, key, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	return io.ReadAll(resp.Body)
+}
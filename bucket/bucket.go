@@ -0,0 +1,122 @@
+package bucket
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Object describes a single job file stored in a bucket.
+type Object struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+	// ETag changes whenever the object's content does.
+	ETag string
+	// Version identifies the object's content for DownloadRange: the ETag
+	// on S3 and Azure, the generation on GCS.
+	Version string
+	// Metadata is the user metadata written at upload time, empty when
+	// the backend doesn't list it (S3).
+	Metadata map[string]string
+}
+
+// UploadOptions are the object attributes written along with its body.
+type UploadOptions struct {
+	// Metadata keys must be lowercase identifiers (letters, digits,
+	// underscores) so they survive every backend's naming rules.
+	Metadata map[string]string
+	// ContentEncoding is set on the object, e.g. gzip.
+	ContentEncoding string
+}
+
+// Bucket is the blob storage the ingester uploads job files to and the
+// querier lists and downloads them from.
+type Bucket interface {
+	// Name returns the bucket URL, e.g. gs://my-bucket
+	Name() string
+	// Upload writes body to key along with user metadata and content
+	// encoding.
+	Upload(ctx context.Context, key string, body []byte, opts UploadOptions) error
+	// List returns every object whose key starts with prefix.
+	List(ctx context.Context, prefix string) ([]Object, error)
+	Download(ctx context.Context, key string) ([]byte, error)
+	// DownloadRange returns length bytes of key starting at offset. It fails
+	// if the object is no longer at version, when set, so the ranges of one
+	// download come from the same upload.
+	DownloadRange(ctx context.Context, key, version string, offset, length int64) ([]byte, error)
+}
+
+// Config holds the flags shared by every subcommand that talks to a bucket.
+type Config struct {
+	// URL selects the backend by scheme: s3://name, gs://name or
+	// azblob://container. A bare name is treated as s3.
+	URL       string
+	Endpoint  string
+	KeyId     string
+	SecretKey string
+	// Prefix namespaces the job files inside the bucket, e.g. team-a/. The
+	// flag goes through CleanPrefix.
+	Prefix string
+	// Profile and Region only apply to s3.
+	Profile string
+	Region  string
+}
+
+// RegisterFlags binds the bucket flags to fs.
+func (c *Config) RegisterFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.URL, "bucket", "", "Bucket URL: s3://name (default), gs://name or azblob://container")
+	fs.StringVar(&c.Endpoint, "endpoint", "", "Storage endpoint (R2/S3 endpoint, GCS endpoint or Azure service URL)")
+	fs.StringVar(&c.KeyId, "keyId", "", "Access key id (optional for s3, defaults to the AWS credential chain)")
+	fs.StringVar(&c.SecretKey, "secretKey", "", "Secret access key")
+	fs.Func("prefix", "Key prefix to upload to / list from, e.g. team-a/", func(prefix string) error {
+		c.Prefix = CleanPrefix(prefix)
+		return nil
+	})
+	fs.StringVar(&c.Profile, "profile", "", "AWS shared config profile")
+	fs.StringVar(&c.Region, "region", "", "AWS region (defaults to the AWS config, or \"auto\" with --endpoint)")
+}
+
+// Open returns the Bucket backend matching the scheme of cfg.URL.
+func Open(ctx context.Context, cfg Config) (Bucket, error) {
+	scheme, name, found := strings.Cut(cfg.URL, "://")
+	if !found {
+		scheme, name = "s3", cfg.URL
+	}
+	name = strings.TrimSuffix(name, "/")
+	if name == "" {
+		return nil, fmt.Errorf("missing bucket name in %q", cfg.URL)
+	}
+
+	switch scheme {
+	case "s3":
+		return NewS3(ctx, name, cfg)
+	case "gs":
+		return NewGCS(ctx, name, cfg)
+	case "azblob":
+		return NewAzureBlob(ctx, name, cfg)
+	default:
+		return nil, fmt.Errorf("unsupported bucket scheme %q", scheme)
+	}
+}
+
+// CleanPrefix returns prefix as a folder, with one trailing slash, so that
+// listing team-a doesn't pick up team-ab/ or team-a-staging/. An empty
+// prefix stays empty.
+func CleanPrefix(prefix string) string {
+	prefix = strings.Trim(prefix, "/")
+	if prefix == "" {
+		return ""
+	}
+	return prefix + "/"
+}
+
+// Key joins prefix and name into an object key.
+func Key(prefix string, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return strings.TrimSuffix(prefix, "/") + "/" + name
+}
@@ -0,0 +1,205 @@
+package bucket
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+)
+
+// The backends are tested against local emulators, the tests skip when they
+// aren't configured:
+//
+//	docker run -d -p 4443:4443 fsouza/fake-gcs-server -scheme http
+//	STORAGE_EMULATOR_HOST=localhost:4443 go test ./bucket
+//
+//	docker run -d -p 10000:10000 mcr.microsoft.com/azure-storage/azurite azurite-blob --blobHost 0.0.0.0
+//	AZURE_STORAGE_CONNECTION_STRING="DefaultEndpointsProtocol=http;AccountName=devstoreaccount1;..." go test ./bucket
+
+func TestGCS(t *testing.T) {
+	if os.Getenv("STORAGE_EMULATOR_HOST") == "" {
+		t.Skip("STORAGE_EMULATOR_HOST is not set")
+	}
+	ctx := context.Background()
+	name := testBucketName()
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	if err := client.Bucket(name).Create(ctx, "test", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := Open(ctx, Config{URL: "gs://" + name})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testBucket(t, b)
+}
+
+func TestGCSRejectsKeys(t *testing.T) {
+	_, err := Open(context.Background(), Config{URL: "gs://b", KeyId: "id", SecretKey: "secret"})
+	if err == nil {
+		t.Error("Open(gs:// with --keyId) succeeded, want an error")
+	}
+}
+
+func TestAzureBlob(t *testing.T) {
+	connStr := os.Getenv("AZURE_STORAGE_CONNECTION_STRING")
+	if connStr == "" {
+		t.Skip("AZURE_STORAGE_CONNECTION_STRING is not set")
+	}
+	ctx := context.Background()
+	name := testBucketName()
+	client, err := azblob.NewClientFromConnectionString(connStr, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.CreateContainer(ctx, name, nil); err != nil {
+		t.Fatal(err)
+	}
+	defer client.DeleteContainer(ctx, name, nil)
+
+	b, err := Open(ctx, Config{URL: "azblob://" + name})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testBucket(t, b)
+}
+
+func testBucketName() string {
+	return fmt.Sprintf("eph-test-%d", time.Now().UnixNano())
+}
+
+// testBucket runs the Bucket contract against an empty bucket.
+func testBucket(t *testing.T, b Bucket) {
+	ctx := context.Background()
+	plain := bytes.Repeat([]byte("up{job=\"a\"} 1 1000\n"), 1000)
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	w.Write(plain)
+	w.Close()
+
+	meta := map[string]string{"job_name": "loadtest", "samples": "1000"}
+	if err := b.Upload(ctx, Key("team-a", "job.txt"), plain, UploadOptions{Metadata: meta}); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Upload(ctx, Key("team-a", "job.txt.gz"), gz.Bytes(), UploadOptions{Metadata: meta, ContentEncoding: "gzip"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Upload(ctx, Key("team-ab", "other.txt"), plain, UploadOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	objects, err := b.List(ctx, "team-a/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored := map[string][]byte{"team-a/job.txt": plain, "team-a/job.txt.gz": gz.Bytes()}
+	if len(objects) != len(stored) {
+		t.Fatalf("List(team-a/) returned %d objects, want %d", len(objects), len(stored))
+	}
+	for _, obj := range objects {
+		want, ok := stored[obj.Key]
+		if !ok {
+			t.Errorf("List(team-a/) returned %s", obj.Key)
+			continue
+		}
+		if obj.Size != int64(len(want)) {
+			t.Errorf("%s: size %d, want %d", obj.Key, obj.Size, len(want))
+		}
+		if obj.ETag == "" || obj.Version == "" || obj.LastModified.IsZero() {
+			t.Errorf("%s: ETag %q, Version %q, LastModified %s, want them set", obj.Key, obj.ETag, obj.Version, obj.LastModified)
+		}
+		if obj.Metadata["job_name"] != "loadtest" || obj.Metadata["samples"] != "1000" {
+			t.Errorf("%s: metadata %v, want %v", obj.Key, obj.Metadata, meta)
+		}
+
+		// Both read the stored bytes, gzip objects aren't transcoded.
+		data, err := b.Download(ctx, obj.Key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, want) {
+			t.Errorf("Download(%s) returned %d bytes, want the %d stored", obj.Key, len(data), len(want))
+		}
+		part, err := b.DownloadRange(ctx, obj.Key, obj.Version, 10, 20)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(part, want[10:30]) {
+			t.Errorf("DownloadRange(%s, 10, 20) = %q, want %q", obj.Key, part, want[10:30])
+		}
+
+		// A new upload makes the listed version stale.
+		if err := b.Upload(ctx, obj.Key, want, UploadOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := b.DownloadRange(ctx, obj.Key, obj.Version, 0, 10); err == nil {
+			t.Errorf("DownloadRange(%s) at a replaced version succeeded, want an error", obj.Key)
+		}
+	}
+}
+
+func TestCleanPrefix(t *testing.T) {
+	tests := []struct {
+		prefix, want, key string
+	}{
+		{"", "", "job.txt"},
+		{"/", "", "job.txt"},
+		{"team-a", "team-a/", "team-a/job.txt"},
+		{"team-a/", "team-a/", "team-a/job.txt"},
+		{"/team-a//", "team-a/", "team-a/job.txt"},
+		{"team-a/2026", "team-a/2026/", "team-a/2026/job.txt"},
+	}
+	for _, tt := range tests {
+		got := CleanPrefix(tt.prefix)
+		if got != tt.want {
+			t.Errorf("CleanPrefix(%q) = %q, want %q", tt.prefix, got, tt.want)
+		}
+		if key := Key(got, "job.txt"); key != tt.key {
+			t.Errorf("Key(%q, job.txt) = %q, want %q", got, key, tt.key)
+		}
+	}
+}
+
+// TestAzureBlobKeepsGzip checks that a blob stored with Content-Encoding:
+// gzip downloads as stored, Go's transport would gunzip it otherwise.
+func TestAzureBlobKeepsGzip(t *testing.T) {
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	w.Write([]byte("up 1 1000\n"))
+	w.Close()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Header().Set("Content-Length", strconv.Itoa(gz.Len()))
+		w.Write(gz.Bytes())
+	}))
+	defer srv.Close()
+	// The well known Azurite account key.
+	t.Setenv("AZURE_STORAGE_CONNECTION_STRING", "DefaultEndpointsProtocol=http;AccountName=devstoreaccount1;"+
+		"AccountKey=Eby8vdM02xNOcqFlqUwJPLlmEtlCDXJ1OUzFT50uSRZ6IFsuFq2UVErCz4I6tq/K1SZFPTOtr/KBHBeksoGMGw==;"+
+		"BlobEndpoint="+srv.URL+"/devstoreaccount1;")
+
+	b, err := Open(context.Background(), Config{URL: "azblob://test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := b.Download(context.Background(), "job.txt.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, gz.Bytes()) {
+		t.Errorf("Download() = %q, want the stored gzip bytes", data)
+	}
+}
@@ -0,0 +1,141 @@
+package bucket
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+type S3 struct {
+	bucket string
+	client *s3.Client
+}
+
+// NewS3 connects to an S3-compatible bucket (AWS, R2, MinIO...). Static keys
+// are used when given, otherwise credentials come from the default AWS chain:
+// environment, shared config/credentials files, web identity (IRSA) and
+// EC2/ECS metadata.
+func NewS3(ctx context.Context, bucket string, cfg Config) (*S3, error) {
+	if (cfg.KeyId == "") != (cfg.SecretKey == "") {
+		return nil, errors.New("--keyId and --secretKey must be set together")
+	}
+
+	var opts []func(*config.LoadOptions) error
+	if cfg.KeyId != "" {
+		opts = append(opts, config.WithCredentialsProvider(
+			credentials.NewStaticCredentialsProvider(cfg.KeyId, cfg.SecretKey, ""),
+		))
+	}
+	if cfg.Profile != "" {
+		opts = append(opts, config.WithSharedConfigProfile(cfg.Profile))
+	}
+
+	region := cfg.Region
+	if region == "" && cfg.Endpoint != "" {
+		region = "auto" // "auto" works for R2
+	}
+	if region != "" {
+		opts = append(opts, config.WithRegion(region))
+	}
+
+	awsCfg, err := config.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if awsCfg.Region == "" {
+		return nil, errors.New("no AWS region configured, set --region or AWS_REGION")
+	}
+
+	client := s3.NewFromConfig(awsCfg, func(o *s3.Options) {
+		if cfg.Endpoint != "" {
+			o.BaseEndpoint = aws.String(cfg.Endpoint)
+		}
+	})
+
+	return &S3{bucket: bucket, client: client}, nil
+}
+
+func (b *S3) Name() string {
+	return "s3://" + b.bucket
+}
+
+func (b *S3) Upload(ctx context.Context, key string, body []byte, opts UploadOptions) error {
+	input := &s3.PutObjectInput{
+		Bucket:   aws.String(b.bucket),
+		Key:      aws.String(key),
+		Body:     bytes.NewReader(body),
+		Metadata: opts.Metadata,
+	}
+	if opts.ContentEncoding != "" {
+		input.ContentEncoding = aws.String(opts.ContentEncoding)
+	}
+	_, err := b.client.PutObject(ctx, input)
+	return err
+}
+
+// List leaves Metadata empty, ListObjectsV2 doesn't return it and a
+// HeadObject per job is too slow on large buckets.
+func (b *S3) List(ctx context.Context, prefix string) ([]Object, error) {
+	paginator := s3.NewListObjectsV2Paginator(b.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(b.bucket),
+		Prefix: aws.String(prefix),
+	})
+
+	var objects []Object
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range page.Contents {
+			objects = append(objects, Object{
+				Key:          aws.ToString(obj.Key),
+				Size:         aws.ToInt64(obj.Size),
+				LastModified: aws.ToTime(obj.LastModified),
+				ETag:         strings.Trim(aws.ToString(obj.ETag), `"`),
+				Version:      aws.ToString(obj.ETag),
+			})
+		}
+	}
+
+	return objects, nil
+}
+
+func (b *S3) Download(ctx context.Context, key string) ([]byte, error) {
+	resp, err := b.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(b.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	return io.ReadAll(resp.Body)
+}
+
+func (b *S3) DownloadRange(ctx context.Context, key, version string, offset, length int64) ([]byte, error) {
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(b.bucket),
+		Key:    aws.String(key),
+		Range:  aws.String(fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)),
+	}
+	if version != "" {
+		input.IfMatch = aws.String(version)
+	}
+	resp, err := b.client.GetObject(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	return io.ReadAll(resp.Body)
+}
@@ -0,0 +1,115 @@
+package compression
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Codec is the compression applied to a job file.
+type Codec string
+
+const (
+	None Codec = "none"
+	Gzip Codec = "gzip"
+	Zstd Codec = "zstd"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// ParseCodec returns the codec named by a --compress flag value.
+func ParseCodec(name string) (Codec, error) {
+	switch Codec(name) {
+	case "", None:
+		return None, nil
+	case Gzip, Zstd:
+		return Codec(name), nil
+	}
+	return None, fmt.Errorf("unsupported compression %q, use none, gzip or zstd", name)
+}
+
+// Ext returns the file extension of the codec, including the dot.
+func (c Codec) Ext() string {
+	switch c {
+	case Gzip:
+		return ".gz"
+	case Zstd:
+		return ".zst"
+	}
+	return ""
+}
+
+// ContentEncoding returns the HTTP Content-Encoding of the codec, empty for
+// None.
+func (c Codec) ContentEncoding() string {
+	if c == None {
+		return ""
+	}
+	return string(c)
+}
+
+// Compress returns data compressed with c.
+func (c Codec) Compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch c {
+	case Gzip:
+		w = gzip.NewWriter(&buf)
+	case Zstd:
+		zw, err := zstd.NewWriter(&buf)
+		if err != nil {
+			return nil, err
+		}
+		w = zw
+	default:
+		return data, nil
+	}
+
+	if _, err := w.Write(data); err != nil {
+		w.Close()
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Detect returns the codec data was compressed with, from its magic bytes.
+func Detect(data []byte) Codec {
+	switch {
+	case bytes.HasPrefix(data, gzipMagic):
+		return Gzip
+	case bytes.HasPrefix(data, zstdMagic):
+		return Zstd
+	}
+	return None
+}
+
+// Decompress returns data decompressed according to its magic bytes, data
+// itself when it isn't compressed.
+func Decompress(data []byte) ([]byte, error) {
+	switch Detect(data) {
+	case Gzip:
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return io.ReadAll(r)
+	case Zstd:
+		d, err := zstd.NewReader(nil)
+		if err != nil {
+			return nil, err
+		}
+		defer d.Close()
+		return d.DecodeAll(data, nil)
+	}
+	return data, nil
+}
@@ -0,0 +1,78 @@
+package compression
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	data := bytes.Repeat([]byte("# EPH-SCRAPE 1000 host:80\nup{job=\"a\"} 1\n"), 1000)
+	for _, codec := range []Codec{None, Gzip, Zstd} {
+		t.Run(string(codec), func(t *testing.T) {
+			compressed, err := codec.Compress(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if codec != None && len(compressed) >= len(data) {
+				t.Errorf("compressed to %d bytes, want less than %d", len(compressed), len(data))
+			}
+			if got := Detect(compressed); got != codec {
+				t.Errorf("Detect() = %s, want %s", got, codec)
+			}
+			got, err := Decompress(compressed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Errorf("Decompress() returned %d bytes, want the %d bytes compressed", len(got), len(data))
+			}
+		})
+	}
+}
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		data []byte
+		want Codec
+	}{
+		{nil, None},
+		{[]byte("up 1 1000\n"), None},
+		{[]byte{0x1f}, None},
+		{[]byte{0x1f, 0x8b, 0x08}, Gzip},
+		{[]byte{0x28, 0xb5, 0x2f}, None},
+		{[]byte{0x28, 0xb5, 0x2f, 0xfd, 0x04}, Zstd},
+	}
+	for _, tt := range tests {
+		if got := Detect(tt.data); got != tt.want {
+			t.Errorf("Detect(%x) = %s, want %s", tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestDecompressCorrupt(t *testing.T) {
+	for _, data := range [][]byte{{0x1f, 0x8b, 0x00}, {0x28, 0xb5, 0x2f, 0xfd, 0xff}} {
+		if _, err := Decompress(data); err == nil {
+			t.Errorf("Decompress(%x) succeeded, want an error", data)
+		}
+	}
+}
+
+func TestParseCodec(t *testing.T) {
+	tests := []struct {
+		name string
+		want Codec
+		ok   bool
+	}{
+		{"", None, true},
+		{"none", None, true},
+		{"gzip", Gzip, true},
+		{"zstd", Zstd, true},
+		{"lz4", None, false},
+	}
+	for _, tt := range tests {
+		got, err := ParseCodec(tt.name)
+		if got != tt.want || (err == nil) != tt.ok {
+			t.Errorf("ParseCodec(%q) = %s, %v, want %s, ok %v", tt.name, got, err, tt.want, tt.ok)
+		}
+	}
+}
@@ -8,15 +8,15 @@ import (
 	"flag"
 	"fmt"
 	"io"
+	"jcosta/ephemeral-prom/bucket"
+	"jcosta/ephemeral-prom/compression"
+	"jcosta/ephemeral-prom/manifest"
 	"log"
 	"net/http"
+	"os"
 	"strings"
 	"time"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/credentials"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/oklog/ulid/v2"
 )
 
@@ -30,54 +30,40 @@ func Run(args []string) {
 	duration := fs.Int("d", 30, "Seconds to scrape for")
 	id := fs.String("id", "", "Job id")
 	output := fs.String("o", "", "Output file")
-	keyId := fs.String("keyId", "", "Access key id")
-	secretKey := fs.String("secretKey", "", "Secret access key")
-	bucket := fs.String("bucket", "", "S3 bucket name")
+	jobName := fs.String("job", "", "Job name, stored in the object metadata")
+	tenant := fs.String("tenant", "", "Tenant, available to --key-template")
+	compress := fs.String("compress", "none", "Compress the job file: none, gzip or zstd")
+	keyTemplate := fs.String("key-template", DefaultKeyTemplate, "Object key template, e.g. {{.Tenant}}/{{.Date}}/{{.JobName}}/{{.ID}}.{{.Ext}}")
 
-	endpoint := fs.String("endpoint", "", "R2 endpoint")
+	var bucketCfg bucket.Config
+	bucketCfg.RegisterFlags(fs)
 
 	// Parse arguments for this subcommand
 	if err := fs.Parse(args); err != nil {
 		log.Fatalf("Failed to parse args: %v", err)
 	}
 
-	client := &s3.Client{}
+	var dest bucket.Bucket
 
 	if *output == "" {
-		fmt.Println("Outputting to R2...")
-		if *keyId == "" {
-			log.Fatal("Error: --keyId is required")
-		}
-		if *endpoint == "" {
-			log.Fatal("Error: --endpoint is required")
-		}
-		if *secretKey == "" {
-			log.Fatal("Error: --secretKey is required")
-		}
-
-		if *bucket == "" {
+		fmt.Println("Outputting to bucket...")
+		if bucketCfg.URL == "" {
 			log.Fatal("Error: --bucket is required")
 		}
 
-		// Create static credentials provider
-		creds := credentials.NewStaticCredentialsProvider(*keyId, *secretKey, "")
-
-		// Load AWS config without worrying about the global resolver
-		cfg, err := config.LoadDefaultConfig(
-			context.Background(),
-			config.WithCredentialsProvider(creds),
-			config.WithRegion("auto"), // "auto" works for R2
-		)
+		var err error
+		dest, err = bucket.Open(context.Background(), bucketCfg)
 		if err != nil {
-			log.Fatalf("failed to load AWS config: %v", err)
+			log.Fatalf("failed to open bucket: %v", err)
 		}
 
-		client = s3.NewFromConfig(cfg, func(o *s3.Options) {
-			o.BaseEndpoint = aws.String(*endpoint)
-		})
-
 	} else {
-		fmt.Printf("Outputting to file %s", *output)
+		fmt.Printf("Outputting to file %s\n", *output)
+	}
+
+	codec, err := compression.ParseCodec(*compress)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
 	}
 
 	if *scrapeTarget == "" {
@@ -95,6 +81,17 @@ func Run(args []string) {
 
 	fmt.Printf("Job will be saved with id %s\n", *id)
 
+	keyData := KeyData{
+		Tenant:  *tenant,
+		Date:    time.Now().UTC().Format("2006-01-02"),
+		JobName: *jobName,
+		ID:      *id,
+		Ext:     "txt" + codec.Ext(),
+	}
+	if _, err := RenderKey(*keyTemplate, keyData); err != nil {
+		log.Fatalf("Error: invalid --key-template: %v", err)
+	}
+
 	fmt.Println("Validated inputs.")
 
 	startTime := time.Now()
@@ -118,33 +115,72 @@ func Run(args []string) {
 			panic(err)
 		}
 
-		processedMetrics := AddTimestamp(rawMetrics)
+		scrapeTime := time.Now()
+		processedMetrics := AddTimestamp(rawMetrics, scrapeTime)
 
 		resp.Body.Close()
 
-		// Append to buffer
-		buffer = append(buffer, string(processedMetrics))
+		// Append to buffer, each scrape as its own record
+		buffer = append(buffer, manifest.ScrapeHeader(scrapeTime, *scrapeTarget)+string(processedMetrics))
 	}
 
-	// Flush buffer to output file
-	//if err := os.WriteFile(*output, []byte(joinWithNewlines(buffer)), 0644); err != nil {
-	//	fmt.Printf("Failed to write output file: %v\n", err)
-	//	return
-	//}
-	// Upload object
+	data, err := codec.Compress([]byte(joinWithNewlines(buffer)))
+	if err != nil {
+		log.Fatalf("failed to compress job file: %v", err)
+	}
+	jobManifest := BuildManifest(buffer)
+	jobManifest.Compression = string(codec)
+	jobManifest.ID = *id
+	jobManifest.JobName = *jobName
+	jobManifest.Start = startTime
+	jobManifest.End = time.Now()
+	jobManifest.Targets = []string{*scrapeTarget}
+
+	manifestData, err := jobManifest.Marshal()
+	if err != nil {
+		log.Fatalf("failed to encode manifest: %v", err)
+	}
+
+	if dest == nil {
+		// Flush buffer to output file
+		outputFile := withExt(*output, codec.Ext())
+		if err := os.WriteFile(outputFile, data, 0644); err != nil {
+			log.Fatalf("failed to write output file: %v", err)
+		}
+		if err := os.WriteFile(manifest.Key(outputFile), manifestData, 0644); err != nil {
+			log.Fatalf("failed to write manifest file: %v", err)
+		}
+		fmt.Printf("Scraping complete. Output saved to %s\n", outputFile)
+		return
+	}
 
-	_, err := client.PutObject(context.Background(), &s3.PutObjectInput{
-		Bucket: bucket,
-		Key:    id,
-		Body:   bytes.NewReader([]byte(joinWithNewlines(buffer))),
-	})
+	// Upload object
+	name, err := RenderKey(*keyTemplate, keyData)
 	if err != nil {
+		log.Fatalf("failed to render object key: %v", err)
+	}
+	key := bucket.Key(bucketCfg.Prefix, withExt(name, codec.Ext()))
+	uploadOpts := bucket.UploadOptions{
+		Metadata:        Metadata(jobManifest),
+		ContentEncoding: codec.ContentEncoding(),
+	}
+	if err := dest.Upload(context.Background(), key, data, uploadOpts); err != nil {
 		log.Fatalf("failed to upload object: %v", err)
 	}
+	if err := dest.Upload(context.Background(), manifest.Key(key), manifestData, bucket.UploadOptions{}); err != nil {
+		log.Fatalf("failed to upload manifest: %v", err)
+	}
 
-	fmt.Printf("Scraping complete. Output saved to %s\n", *output)
-	// flust buffer to output file
+	fmt.Printf("Scraping complete. Output saved to %s/%s\n", dest.Name(), key)
+}
 
+// withExt appends ext to name unless it already ends with it, so compressed
+// files are recognisable whatever --o or --key-template says.
+func withExt(name, ext string) string {
+	if strings.HasSuffix(name, ext) {
+		return name
+	}
+	return name + ext
 }
 
 func joinWithNewlines(lines []string) string {
@@ -155,11 +191,11 @@ func joinWithNewlines(lines []string) string {
 	return result
 }
 
-// AddTimestamp takes Prometheus metrics in []byte form and appends a timestamp
-// (in milliseconds) to every metric line that is not a comment (#...).
-func AddTimestamp(metrics []byte) []byte {
+// AddTimestamp takes Prometheus metrics in []byte form and appends the scrape
+// timestamp (in milliseconds) to every metric line that is not a comment (#...).
+func AddTimestamp(metrics []byte, scrapeTime time.Time) []byte {
 	var buffer bytes.Buffer
-	nowMillis := time.Now().UnixMilli()
+	nowMillis := scrapeTime.UnixMilli()
 
 	reader := bufio.NewReader(bytes.NewReader(metrics))
 	for {
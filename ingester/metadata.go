@@ -0,0 +1,139 @@
+package ingester
+
+import (
+	"bytes"
+	"fmt"
+	"jcosta/ephemeral-prom/manifest"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// Version is the ingester version written to every job's metadata.
+// Override at build time with -ldflags "-X jcosta/ephemeral-prom/ingester.Version=v1.2.3"
+var Version = "dev"
+
+// FormatVersion identifies the layout of the job file written by the ingester.
+// Version 2 opens every scrape with a manifest.ScrapeHeader line.
+const FormatVersion = "2"
+
+const DefaultKeyTemplate = "{{.ID}}"
+
+// KeyData holds the fields available to --key-template.
+type KeyData struct {
+	Tenant  string
+	Date    string
+	JobName string
+	ID      string
+	Ext     string
+}
+
+// RenderKey executes the key template for a job. It fails when the key has
+// an empty path segment, e.g. {{.Tenant}}/{{.ID}} without --tenant.
+func RenderKey(keyTemplate string, data KeyData) (string, error) {
+	tmpl, err := template.New("key").Option("missingkey=error").Parse(keyTemplate)
+	if err != nil {
+		return "", err
+	}
+
+	var key bytes.Buffer
+	if err := tmpl.Execute(&key, data); err != nil {
+		return "", err
+	}
+	if slices.Contains(strings.Split(key.String(), "/"), "") {
+		return "", fmt.Errorf("key %q has an empty path segment, set the fields it uses (--tenant, --job)", key.String())
+	}
+	return key.String(), nil
+}
+
+// BuildManifest summarises the timestamped scrapes produced by AddTimestamp.
+func BuildManifest(scrapes []string) manifest.Manifest {
+	m := manifest.Manifest{
+		Format:        "prometheus-text",
+		FormatVersion: FormatVersion,
+		Scrapes:       len(scrapes),
+	}
+
+	series := map[string]struct{}{}
+	metricNames := map[string]struct{}{}
+	labelNames := map[string]struct{}{}
+	for _, scrape := range scrapes {
+		for _, line := range strings.Split(scrape, "\n") {
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+
+			// Split off the trailing "<value> <timestamp>" to keep the series.
+			s := line
+			var ts string
+			if i := strings.LastIndexByte(s, ' '); i >= 0 {
+				s, ts = s[:i], s[i+1:]
+			}
+			if i := strings.LastIndexByte(s, ' '); i >= 0 {
+				s = s[:i]
+			}
+
+			m.Samples++
+			if t, err := strconv.ParseInt(ts, 10, 64); err == nil {
+				if m.MinTime == 0 || t < m.MinTime {
+					m.MinTime = t
+				}
+				if t > m.MaxTime {
+					m.MaxTime = t
+				}
+			}
+
+			series[s] = struct{}{}
+			name, lbls, _ := strings.Cut(s, "{")
+			metricNames[strings.TrimSpace(name)] = struct{}{}
+			for _, l := range parseLabelNames(lbls) {
+				labelNames[l] = struct{}{}
+			}
+		}
+	}
+
+	m.Series = len(series)
+	m.MetricNames = slices.Sorted(maps.Keys(metricNames))
+	m.LabelNames = slices.Sorted(maps.Keys(labelNames))
+	return m
+}
+
+// parseLabelNames returns the label names of a `a="x",b="y"}` label block.
+func parseLabelNames(lbls string) []string {
+	var names []string
+	for len(lbls) > 0 {
+		lbls = strings.TrimLeft(lbls, ", ")
+		eq := strings.IndexByte(lbls, '=')
+		if eq < 0 {
+			break
+		}
+		names = append(names, strings.TrimSpace(lbls[:eq]))
+
+		// Skip the quoted value, honouring escapes.
+		rest := lbls[eq+1:]
+		if !strings.HasPrefix(rest, "\"") {
+			break
+		}
+		i := 1
+		for i < len(rest) && rest[i] != '"' {
+			if rest[i] == '\\' {
+				i++
+			}
+			i++
+		}
+		if i >= len(rest) {
+			break
+		}
+		lbls = rest[i+1:]
+	}
+	return names
+}
+
+// Metadata returns the object metadata stored alongside a job file.
+func Metadata(m manifest.Manifest) map[string]string {
+	meta := m.Metadata()
+	meta["ingester_version"] = Version
+	return meta
+}
@@ -0,0 +1,58 @@
+package ingester
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRenderKey(t *testing.T) {
+	const hierarchical = "{{.Tenant}}/{{.Date}}/{{.JobName}}/{{.ID}}.{{.Ext}}"
+	data := KeyData{Tenant: "team-a", Date: "2026-10-18", JobName: "loadtest", ID: "01J", Ext: "txt.gz"}
+	tests := []struct {
+		template string
+		data     KeyData
+		want     string
+		ok       bool
+	}{
+		{DefaultKeyTemplate, data, "01J", true},
+		{hierarchical, data, "team-a/2026-10-18/loadtest/01J.txt.gz", true},
+		{hierarchical, KeyData{Date: "2026-10-18", JobName: "loadtest", ID: "01J", Ext: "txt"}, "", false},
+		{hierarchical, KeyData{Date: "2026-10-18", ID: "01J", Ext: "txt"}, "", false},
+		{"/{{.ID}}", data, "", false},
+		{"{{.ID}}/", data, "", false},
+		{"{{.Missing}}", data, "", false},
+		{"{{.ID", data, "", false},
+	}
+	for _, tt := range tests {
+		got, err := RenderKey(tt.template, tt.data)
+		if got != tt.want || (err == nil) != tt.ok {
+			t.Errorf("RenderKey(%q, %+v) = %q, %v, want %q, ok %v", tt.template, tt.data, got, err, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestBuildManifest(t *testing.T) {
+	scrapes := []string{
+		"# HELP up whether the target is up\n" +
+			string(AddTimestamp([]byte("up 1\nhttp_requests_total{code=\"200\",path=\"/a b\"} 10\n"), time.UnixMilli(2000))),
+		string(AddTimestamp([]byte("up 1\nhttp_requests_total{code=\"500\",path=\"/\"} 1\n"), time.UnixMilli(1000))),
+	}
+	m := BuildManifest(scrapes)
+
+	if m.FormatVersion != FormatVersion || m.Scrapes != 2 {
+		t.Errorf("FormatVersion %q, Scrapes %d, want %q, 2", m.FormatVersion, m.Scrapes, FormatVersion)
+	}
+	if m.Samples != 4 || m.Series != 3 {
+		t.Errorf("Samples %d, Series %d, want 4, 3", m.Samples, m.Series)
+	}
+	if m.MinTime != 1000 || m.MaxTime != 2000 {
+		t.Errorf("MinTime %d, MaxTime %d, want 1000, 2000", m.MinTime, m.MaxTime)
+	}
+	if want := []string{"http_requests_total", "up"}; !reflect.DeepEqual(m.MetricNames, want) {
+		t.Errorf("MetricNames = %v, want %v", m.MetricNames, want)
+	}
+	if want := []string{"code", "path"}; !reflect.DeepEqual(m.LabelNames, want) {
+		t.Errorf("LabelNames = %v, want %v", m.LabelNames, want)
+	}
+}
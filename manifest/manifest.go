@@ -0,0 +1,73 @@
+package manifest
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Suffix is appended to a job's object key to get its manifest key.
+const Suffix = ".manifest.json"
+
+// Manifest summarises a job file so it can be listed and filtered without
+// downloading it.
+type Manifest struct {
+	ID            string `json:"id"`
+	JobName       string `json:"job_name,omitempty"`
+	Format        string `json:"format"`
+	FormatVersion string `json:"format_version"`
+	// Compression is the codec of the job file: none, gzip or zstd.
+	Compression string    `json:"compression,omitempty"`
+	Start       time.Time `json:"start"`
+	End         time.Time `json:"end"`
+	// MinTime and MaxTime are the sample time bounds in unix ms.
+	MinTime     int64    `json:"min_time"`
+	MaxTime     int64    `json:"max_time"`
+	Samples     int      `json:"samples"`
+	Series      int      `json:"series"`
+	Scrapes     int      `json:"scrapes"`
+	Targets     []string `json:"targets"`
+	MetricNames []string `json:"metric_names"`
+	LabelNames  []string `json:"label_names"`
+}
+
+// Key returns the manifest key for the job stored at jobKey.
+func Key(jobKey string) string {
+	return jobKey + Suffix
+}
+
+// IsManifest reports whether key points to a manifest rather than a job file.
+func IsManifest(key string) bool {
+	return strings.HasSuffix(key, Suffix)
+}
+
+// JobKey returns the job key a manifest key belongs to.
+func JobKey(key string) string {
+	return strings.TrimSuffix(key, Suffix)
+}
+
+// Metadata returns the manifest fields stored as object metadata.
+func (m Manifest) Metadata() map[string]string {
+	return map[string]string{
+		"job_name":       m.JobName,
+		"start":          strconv.FormatInt(m.Start.UnixMilli(), 10),
+		"end":            strconv.FormatInt(m.End.UnixMilli(), 10),
+		"samples":        strconv.Itoa(m.Samples),
+		"series":         strconv.Itoa(m.Series),
+		"format_version": m.FormatVersion,
+		"compression":    m.Compression,
+	}
+}
+
+func Parse(data []byte) (*Manifest, error) {
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+func (m Manifest) Marshal() ([]byte, error) {
+	return json.MarshalIndent(m, "", "  ")
+}
@@ -0,0 +1,38 @@
+package manifest
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// ScrapePrefix starts the comment line opening every scrape record of a job
+// file (format version 2 onwards):
+//
+//	# EPH-SCRAPE <unix ms> <target>
+//
+// The lines up to the next header belong to that scrape. Being a comment, it
+// is ignored by any Prometheus text parser.
+const ScrapePrefix = "# EPH-SCRAPE "
+
+// ScrapeHeader returns the header line of a scrape of target taken at t.
+func ScrapeHeader(t time.Time, target string) string {
+	return fmt.Sprintf("%s%d %s\n", ScrapePrefix, t.UnixMilli(), target)
+}
+
+// ParseScrapeHeader returns the timestamp and target of a scrape header line,
+// ok is false if line isn't one.
+func ParseScrapeHeader(line []byte) (ts int64, target string, ok bool) {
+	rest, found := bytes.CutPrefix(line, []byte(ScrapePrefix))
+	if !found {
+		return 0, "", false
+	}
+	rest = bytes.TrimSpace(rest)
+	tsField, targetField, _ := bytes.Cut(rest, []byte(" "))
+	ts, err := strconv.ParseInt(string(tsField), 10, 64)
+	if err != nil {
+		return 0, "", false
+	}
+	return ts, string(bytes.TrimSpace(targetField)), true
+}
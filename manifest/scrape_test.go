@@ -0,0 +1,40 @@
+package manifest
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseScrapeHeader(t *testing.T) {
+	tests := []struct {
+		line   string
+		ts     int64
+		target string
+		ok     bool
+	}{
+		{"# EPH-SCRAPE 1754335979103 localhost:9182", 1754335979103, "localhost:9182", true},
+		{"# EPH-SCRAPE 5000", 5000, "", true},
+		{"# EPH-SCRAPE  5000  host:80 ", 5000, "host:80", true},
+		{"# EPH-SCRAPE now host:80", 0, "", false},
+		{"# EPH-SCRAPE ", 0, "", false},
+		{"# HELP up whether the target is up", 0, "", false},
+		{"up 1 5000", 0, "", false},
+		{"", 0, "", false},
+	}
+	for _, tt := range tests {
+		ts, target, ok := ParseScrapeHeader([]byte(tt.line))
+		if ts != tt.ts || target != tt.target || ok != tt.ok {
+			t.Errorf("ParseScrapeHeader(%q) = %d, %q, %v, want %d, %q, %v",
+				tt.line, ts, target, ok, tt.ts, tt.target, tt.ok)
+		}
+	}
+}
+
+func TestScrapeHeaderRoundTrip(t *testing.T) {
+	at := time.UnixMilli(1754335979103)
+	line := ScrapeHeader(at, "localhost:9182")
+	ts, target, ok := ParseScrapeHeader([]byte(line[:len(line)-1]))
+	if !ok || ts != at.UnixMilli() || target != "localhost:9182" {
+		t.Errorf("ParseScrapeHeader(%q) = %d, %q, %v", line, ts, target, ok)
+	}
+}
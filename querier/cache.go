@@ -0,0 +1,196 @@
+package querier
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultCacheSize is the default download cache cap in bytes.
+const DefaultCacheSize = 2 << 30
+
+// Cache keeps downloaded job files on disk across runs. Entries are addressed
+// by a hash of bucket, key and ETag, so a re-uploaded object is a different
+// entry and never served stale. When the cache grows past its cap the least
+// recently used entries are removed.
+type Cache struct {
+	dir     string
+	maxSize int64
+	mu      sync.Mutex
+}
+
+// DefaultCacheDir returns the eph directory inside the user cache dir.
+func DefaultCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return filepath.Join(os.TempDir(), "eph-cache")
+	}
+	return filepath.Join(dir, "eph")
+}
+
+// OpenCache returns the cache stored in dir, nil if maxSize is 0 (disabled).
+func OpenCache(dir string, maxSize int64) (*Cache, error) {
+	if maxSize <= 0 {
+		return nil, nil
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("creating cache directory: %w", err)
+	}
+	return &Cache{dir: dir, maxSize: maxSize}, nil
+}
+
+func (c *Cache) path(bucket string, file *FileItem) string {
+	sum := sha256.Sum256([]byte(bucket + "\x00" + file.Name + "\x00" + file.ETag))
+	name := hex.EncodeToString(sum[:])
+	return filepath.Join(c.dir, name[:2], name)
+}
+
+// Has reports whether file is cached. Files without an ETag are never cached.
+func (c *Cache) Has(bucket string, file *FileItem) bool {
+	if c == nil || file.ETag == "" {
+		return false
+	}
+	_, err := os.Stat(c.path(bucket, file))
+	return err == nil
+}
+
+// Load fills file.Data from the cache and reports whether it was cached.
+func (c *Cache) Load(bucket string, file *FileItem) bool {
+	if c == nil || file.ETag == "" {
+		return false
+	}
+	p := c.path(bucket, file)
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return false
+	}
+	if int64(len(data)) != file.Size {
+		// Truncated by a crash or a full disk, download it again.
+		os.Remove(p)
+		return false
+	}
+
+	// The modification time orders entries for eviction.
+	now := time.Now()
+	os.Chtimes(p, now, now)
+	file.Data = data
+	return true
+}
+
+// Store writes file.Data to the cache and evicts the least recently used
+// entries if the cache is over its cap. An eviction error leaves file
+// cached.
+func (c *Cache) Store(bucket string, file *FileItem) error {
+	if c == nil || file.ETag == "" || int64(len(file.Data)) > c.maxSize {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	p := c.path(bucket, file)
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+	// Write aside and rename so a reader never sees a partial entry.
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".tmp-")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(file.Data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), p); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return c.evict()
+}
+
+// staleTemp is how old a .tmp- file left by an interrupted Store must be
+// before evict removes it, younger ones may still be written by another run.
+const staleTemp = time.Hour
+
+// evict removes the least recently used entries until the cache fits its cap.
+// Only the xx/<sha256> entries count and get removed, whatever else lives in
+// the cache dir is left alone.
+func (c *Cache) evict() error {
+	type entry struct {
+		path    string
+		size    int64
+		modTime time.Time
+	}
+	dirs, err := os.ReadDir(c.dir)
+	if err != nil {
+		return err
+	}
+	var entries []entry
+	var total int64
+	for _, dir := range dirs {
+		if !dir.IsDir() || !isHex(dir.Name(), 2) {
+			continue
+		}
+		files, err := os.ReadDir(filepath.Join(c.dir, dir.Name()))
+		if err != nil {
+			continue
+		}
+		for _, f := range files {
+			info, err := f.Info()
+			if err != nil || !info.Mode().IsRegular() {
+				continue
+			}
+			p := filepath.Join(c.dir, dir.Name(), f.Name())
+			if strings.HasPrefix(f.Name(), ".tmp-") {
+				if time.Since(info.ModTime()) > staleTemp {
+					os.Remove(p)
+				}
+				continue
+			}
+			if !isHex(f.Name(), sha256.Size*2) || !strings.HasPrefix(f.Name(), dir.Name()) {
+				continue
+			}
+			entries = append(entries, entry{path: p, size: info.Size(), modTime: info.ModTime()})
+			total += info.Size()
+		}
+	}
+
+	slices.SortFunc(entries, func(a, b entry) int { return a.modTime.Compare(b.modTime) })
+	var errs []error
+	for _, e := range entries {
+		if total <= c.maxSize {
+			break
+		}
+		if err := os.Remove(e.path); err != nil {
+			errs = append(errs, fmt.Errorf("evicting %s: %w", e.path, err))
+			continue
+		}
+		total -= e.size
+	}
+	return errors.Join(errs...)
+}
+
+// isHex reports whether s is n lowercase hex digits.
+func isHex(s string, n int) bool {
+	if len(s) != n {
+		return false
+	}
+	for _, r := range s {
+		if !('0' <= r && r <= '9' || 'a' <= r && r <= 'f') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,66 @@
+package querier
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCacheEvict(t *testing.T) {
+	dir := t.TempDir()
+	cache, err := OpenCache(dir, 250)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Files that aren't cache entries, including a large one that alone is
+	// over the cap.
+	foreign := []string{filepath.Join(dir, "notes.txt"), filepath.Join(dir, "ab", "notes.txt")}
+	for _, p := range foreign {
+		os.MkdirAll(filepath.Dir(p), 0o755)
+		if err := os.WriteFile(p, bytes.Repeat([]byte("x"), 1000), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files := make([]*FileItem, 3)
+	for i := range files {
+		files[i] = &FileItem{Name: string(rune('a' + i)), ETag: "e", Size: 100, Data: bytes.Repeat([]byte{byte(i)}, 100)}
+		if err := cache.Store("b", files[i]); err != nil {
+			t.Fatal(err)
+		}
+		// Distinct modification times, oldest first.
+		at := time.Now().Add(time.Duration(i-10) * time.Minute)
+		os.Chtimes(cache.path("b", files[i]), at, at)
+	}
+	// A temp file left by a crash, old enough to go.
+	stale := filepath.Join(filepath.Dir(cache.path("b", files[0])), ".tmp-123")
+	os.WriteFile(stale, []byte("partial"), 0o644)
+	old := time.Now().Add(-2 * staleTemp)
+	os.Chtimes(stale, old, old)
+
+	// Over the cap with the third entry, the oldest is evicted.
+	if err := cache.evict(); err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []bool{false, true, true} {
+		if got := cache.Has("b", files[i]); got != want {
+			t.Errorf("entry %d cached %v, want %v", i, got, want)
+		}
+	}
+	for _, p := range foreign {
+		if _, err := os.Stat(p); err != nil {
+			t.Errorf("foreign file %s: %v", p, err)
+		}
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Errorf("stale temp file survived eviction: %v", err)
+	}
+
+	loaded := &FileItem{Name: "c", ETag: "e", Size: 100}
+	if !cache.Load("b", loaded) || !bytes.Equal(loaded.Data, files[2].Data) {
+		t.Error("Load(c) didn't return the stored data")
+	}
+}
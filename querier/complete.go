@@ -0,0 +1,220 @@
+package querier
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/prometheus/prometheus/tsdb"
+)
+
+// maxCompletions bounds the entries of the autocomplete drop-down.
+const maxCompletions = 30
+
+// SessionCommands are the commands ProcessCommand understands, with the
+// keywords each takes as first argument.
+var SessionCommands = map[string][]string{
+	"exit":     nil,
+	"mode":     {"instant", "range"},
+	"time":     {"now", "start", "end", "jobstart", "jobend"},
+	"lookback": nil,
+	"interval": {"start", "end"},
+	"fit":      nil,
+	"metrics":  nil,
+	"explore":  nil,
+	"stats":    nil,
+	"limit":    {"samples", "timeout", "concurrency"},
+	"graph":    nil,
+	"table":    nil,
+	"history":  {"all"},
+	"tab":      {"new", "close"},
+}
+
+var aggregations = []string{
+	"avg", "bottomk", "count", "count_values", "group", "limitk", "limit_ratio",
+	"max", "min", "quantile", "stddev", "stdvar", "sum", "topk",
+}
+
+// grouping keywords take a list of label names in parentheses.
+var grouping = []string{"by", "without", "on", "ignoring", "group_left", "group_right"}
+
+// Completer suggests completions for the query input from the loaded
+// storage. The storage doesn't change after loading, so names are read once
+// and label values are cached.
+type Completer struct {
+	db          *tsdb.DB
+	metricNames []string
+	functions   []string
+	// onError reports failed storage lookups, completion goes on without
+	// their candidates.
+	onError func(err error)
+
+	labelNamesOnce sync.Once
+	labelNames     []string
+
+	mu     sync.Mutex
+	values map[[2]string][]string // metric, label name -> values
+}
+
+func NewCompleter(db *tsdb.DB, onError func(err error)) *Completer {
+	return &Completer{
+		db:          db,
+		metricNames: GetMetricNames(db, ""),
+		functions:   slices.Sorted(maps.Keys(parser.Functions)),
+		onError:     onError,
+		values:      map[[2]string][]string{},
+	}
+}
+
+// names returns the label names of the storage, read on first use.
+func (c *Completer) names() []string {
+	c.labelNamesOnce.Do(func() {
+		q, err := c.db.Querier(c.db.Head().MinTime(), c.db.Head().MaxTime())
+		if err != nil {
+			c.onError(fmt.Errorf("creating querier: %w", err))
+			return
+		}
+		defer q.Close()
+		c.labelNames, _, err = q.LabelNames(context.Background(), nil)
+		if err != nil {
+			c.onError(fmt.Errorf("fetching label names: %w", err))
+		}
+	})
+	return c.labelNames
+}
+
+// labelValues returns the values of name, only on series of metric if set.
+func (c *Completer) labelValues(metric, name string) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := [2]string{metric, name}
+	if values, ok := c.values[key]; ok {
+		return values
+	}
+
+	q, err := c.db.Querier(c.db.Head().MinTime(), c.db.Head().MaxTime())
+	if err != nil {
+		c.onError(fmt.Errorf("creating querier: %w", err))
+		return nil
+	}
+	defer q.Close()
+
+	var matchers []*labels.Matcher
+	if metric != "" {
+		matchers = append(matchers, labels.MustNewMatcher(labels.MatchEqual, labels.MetricName, metric))
+	}
+	values, _, err := q.LabelValues(context.Background(), name, nil, matchers...)
+	if err != nil {
+		c.onError(fmt.Errorf("fetching values of %s: %w", name, err))
+		return nil
+	}
+	c.values[key] = values
+	return values
+}
+
+// Complete returns the text before the word being typed and the candidates
+// for that word, depending on where it is: a session command or its
+// argument, a label name or value inside braces or a grouping clause, or a
+// metric name, function or aggregation.
+func (c *Completer) Complete(text string) (string, []string) {
+	if strings.TrimSpace(text) == "" {
+		return text, nil
+	}
+
+	word := text[len(strings.TrimRightFunc(text, isNameRune)):]
+	prefix := text[:len(text)-len(word)]
+
+	// Session commands and their first argument
+	fields := strings.Fields(text)
+	args, isCommand := SessionCommands[fields[0]]
+	if fields[0] == "explore" {
+		args = c.metricNames
+	}
+	if isCommand && (len(fields) > 1 || strings.HasSuffix(text, " ")) {
+		if len(fields) == 1 || len(fields) == 2 && word != "" {
+			return prefix, matching(args, word, "")
+		}
+		return prefix, nil
+	}
+	if len(fields) == 1 && strings.TrimSpace(text) == word {
+		commands := slices.Sorted(maps.Keys(SessionCommands))
+		return prefix, matching(append(commands, c.exprCandidates()...), word, "")
+	}
+
+	// Inside an unclosed selector: label name, or label value after an
+	// opening quote.
+	if open := strings.LastIndexByte(text, '{'); open > strings.LastIndexByte(text, '}') {
+		metric := text[len(strings.TrimRightFunc(text[:open], isNameRune)):open]
+		matcher := text[strings.LastIndexAny(text, "{,")+1:]
+		if name, value, ok := cutMatcher(matcher); ok {
+			return text[:len(text)-len(value)], matching(c.labelValues(metric, name), value, `"`)
+		}
+		if strings.Count(matcher, `"`)%2 == 1 {
+			return prefix, nil
+		}
+		return prefix, matching(c.names(), word, "")
+	}
+
+	// Inside by (...), without (...), on (...)...
+	if open := strings.LastIndexByte(text, '('); open > strings.LastIndexByte(text, ')') {
+		before := strings.TrimRight(text[:open], " ")
+		keyword := before[len(strings.TrimRightFunc(before, isNameRune)):]
+		if slices.Contains(grouping, keyword) {
+			return prefix, matching(c.names(), word, "")
+		}
+	}
+
+	if word == "" {
+		return prefix, nil
+	}
+	return prefix, matching(c.exprCandidates(), word, "")
+}
+
+// exprCandidates are the words that can start an expression.
+func (c *Completer) exprCandidates() []string {
+	candidates := slices.Clone(c.metricNames)
+	for _, f := range c.functions {
+		candidates = append(candidates, f+"(")
+	}
+	for _, a := range aggregations {
+		candidates = append(candidates, a+"(")
+	}
+	return append(candidates, grouping...)
+}
+
+// cutMatcher splits a `name="partial` label matcher whose value is still
+// being typed.
+func cutMatcher(matcher string) (name, value string, ok bool) {
+	q := strings.IndexByte(matcher, '"')
+	if q < 0 || strings.Count(matcher, `"`) != 1 {
+		return "", "", false
+	}
+	name = strings.TrimRight(strings.TrimSpace(matcher[:q]), "=!~ ")
+	return name, matcher[q+1:], name != ""
+}
+
+// matching returns the candidates starting with word, word itself excluded,
+// each followed by suffix.
+func matching(candidates []string, word, suffix string) []string {
+	var matches []string
+	for _, c := range candidates {
+		if strings.HasPrefix(c, word) && c != word {
+			matches = append(matches, c+suffix)
+		}
+		if len(matches) == maxCompletions {
+			break
+		}
+	}
+	slices.Sort(matches)
+	return slices.Compact(matches)
+}
+
+func isNameRune(r rune) bool {
+	return r == '_' || r == ':' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9'
+}
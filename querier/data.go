@@ -2,13 +2,19 @@ package querier
 
 import (
 	"context"
-	"io"
+	"fmt"
+	"jcosta/ephemeral-prom/bucket"
+	"jcosta/ephemeral-prom/manifest"
 	"log"
+	"os"
+	"path"
+	"slices"
 	"strings"
+	"sync/atomic"
 	"time"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"golang.org/x/sync/errgroup"
+
 	"github.com/prometheus/prometheus/tsdb"
 )
 
@@ -17,52 +23,310 @@ type FileItem struct {
 	Name    string
 	Size    int64
 	Date    time.Time
+	ETag    string
+	// Version pins the ranges of a download to one upload, see
+	// bucket.Object.
+	Version string
 	Data    []byte
+	// Cached is set when Data can be loaded from the download cache.
+	Cached bool
+	// Metadata is the object metadata written by the ingester (job_name,
+	// start, end, samples, series...).
+	Metadata map[string]string
+	// Manifest is nil for jobs uploaded without one.
+	Manifest *manifest.Manifest
 }
 
-func GetFiles(bucket string, client s3.Client) []FileItem {
-	input := &s3.ListObjectsV2Input{
-		Bucket: aws.String(bucket),
+// EphJobLabel is injected into every series when several jobs are loaded
+// into the same storage.
+const EphJobLabel = "eph_job"
+
+// JobLabels returns the eph_job value of every file: the last segment of its
+// key, or the whole key when another file has the same last segment (runs of
+// a job stored under {{.Date}}/{{.JobName}}.txt), numbered when even keys
+// collide.
+func JobLabels(files []*FileItem) []string {
+	bases := map[string]int{}
+	for _, file := range files {
+		bases[path.Base(file.Name)]++
+	}
+	labels := make([]string, len(files))
+	seen := map[string]int{}
+	for i, file := range files {
+		label := path.Base(file.Name)
+		if bases[label] > 1 {
+			label = file.Name
+		}
+		seen[label]++
+		if n := seen[label]; n > 1 {
+			label = fmt.Sprintf("%s#%d", label, n)
+		}
+		labels[i] = label
 	}
+	return labels
+}
 
-	output, err := client.ListObjectsV2(context.Background(), input)
+// LocalFile reads the job file at name, compressed or not, as given to
+// --src.
+func LocalFile(name string) (*FileItem, error) {
+	info, err := os.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return &FileItem{
+		Context: "local",
+		Name:    name,
+		Size:    int64(len(data)),
+		Date:    info.ModTime(),
+		Data:    data,
+	}, nil
+}
+
+// manifestConcurrency bounds the manifest downloads made while listing.
+const manifestConcurrency = 16
+
+func GetFiles(b bucket.Bucket, prefix string) []FileItem {
+	objects, err := b.List(context.Background(), prefix)
 	if err != nil {
 		log.Fatalf("failed to list objects: %v", err)
 	}
 
 	var files []FileItem
-	for _, obj := range output.Contents {
+	manifests := map[string]string{}
+	for _, obj := range objects {
+		if manifest.IsManifest(obj.Key) {
+			manifests[manifest.JobKey(obj.Key)] = obj.Key
+			continue
+		}
 		files = append(files, FileItem{
-			Context: bucket,
-			Name:    aws.ToString(obj.Key),
-			Size:    *obj.Size,
-			Date:    aws.ToTime(obj.LastModified),
+			Context:  b.Name(),
+			Name:     obj.Key,
+			Size:     obj.Size,
+			Date:     obj.LastModified,
+			ETag:     obj.ETag,
+			Version:  obj.Version,
+			Metadata: obj.Metadata,
 		})
 	}
+
+	// Manifests are small, fetch them up front so the table can show and
+	// filter on what's inside each job before it's downloaded.
+	var g errgroup.Group
+	g.SetLimit(manifestConcurrency)
+	for i := range files {
+		key, ok := manifests[files[i].Name]
+		if !ok {
+			continue
+		}
+		g.Go(func() error {
+			data, err := b.Download(context.Background(), key)
+			if err != nil {
+				log.Printf("failed to download manifest %s: %v", key, err)
+				return nil
+			}
+			m, err := manifest.Parse(data)
+			if err != nil {
+				log.Printf("failed to parse manifest %s: %v", key, err)
+				return nil
+			}
+			files[i].Manifest = m
+			if files[i].Metadata == nil {
+				// Listed without metadata (S3), --match uses the manifest.
+				files[i].Metadata = m.Metadata()
+			}
+			return nil
+		})
+	}
+	g.Wait()
+
 	return files
 }
 
-// ✅ This function fills the Data field of the given FileItem
-func DownloadFile(bucket string, file *FileItem, client s3.Client) {
-	input := &s3.GetObjectInput{
-		Bucket: aws.String(bucket),
-		Key:    aws.String(file.Name),
+// FilterFiles keeps the files whose metadata matches every key=value pair in
+// the comma separated match string, e.g. "job_name=loadtest,format_version=1".
+func FilterFiles(files []FileItem, match string) []FileItem {
+	if match == "" {
+		return files
 	}
 
-	resp, err := client.GetObject(context.Background(), input)
-	if err != nil {
-		log.Fatalf("failed to download object %s: %v", file.Name, err)
+	var filtered []FileItem
+	for _, file := range files {
+		ok := true
+		for _, pair := range strings.Split(match, ",") {
+			k, v, _ := strings.Cut(pair, "=")
+			if file.Metadata[strings.TrimSpace(k)] != strings.TrimSpace(v) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			filtered = append(filtered, file)
+		}
 	}
-	defer resp.Body.Close()
+	return filtered
+}
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		log.Fatalf("failed to read object body: %v", err)
+// MatchFile reports whether file matches every space separated term of
+// filter. A term is either field=value, with field one of job, metric, label
+// or target (looked up in the manifest), or a plain substring of the file
+// name, job name or any metric name.
+func MatchFile(file *FileItem, filter string) bool {
+	var metrics, labelNames, targets []string
+	jobName := file.Metadata["job_name"]
+	if m := file.Manifest; m != nil {
+		metrics, labelNames, targets = m.MetricNames, m.LabelNames, m.Targets
+		if m.JobName != "" {
+			jobName = m.JobName
+		}
+	}
+
+	for _, term := range strings.Fields(filter) {
+		field, value, found := strings.Cut(term, "=")
+		if !found {
+			if !strings.Contains(file.Name, term) && !strings.Contains(jobName, term) &&
+				!slices.ContainsFunc(metrics, func(m string) bool { return strings.Contains(m, term) }) {
+				return false
+			}
+			continue
+		}
+
+		switch field {
+		case "job":
+			if jobName != value {
+				return false
+			}
+		case "metric":
+			if !slices.Contains(metrics, value) {
+				return false
+			}
+		case "label":
+			if !slices.Contains(labelNames, value) {
+				return false
+			}
+		case "target":
+			if !slices.Contains(targets, value) {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// TableEntry is a row of the file table: a file or, when browsing by
+// folders, a prefix that can be entered.
+type TableEntry struct {
+	Folder string
+	File   *FileItem
+}
+
+// ListEntries returns the table rows for dir, skipping files that don't match
+// filter. Without folders every file is listed flat; with folders, keys are
+// grouped by their next "/" segment below dir and a ".." entry leads back up
+// until root is reached.
+func ListEntries(files []FileItem, root string, dir string, folders bool, filter string) []TableEntry {
+	var entries []TableEntry
+	if !folders {
+		for i := range files {
+			if MatchFile(&files[i], filter) {
+				entries = append(entries, TableEntry{File: &files[i]})
+			}
+		}
+		return entries
+	}
+
+	if dir != root {
+		parent := strings.TrimSuffix(dir, "/")
+		if i := strings.LastIndex(parent, "/"); i >= 0 {
+			parent = parent[:i+1]
+		} else {
+			parent = ""
+		}
+		if len(parent) < len(root) {
+			parent = root
+		}
+		entries = append(entries, TableEntry{Folder: parent})
+	}
+
+	seen := map[string]bool{}
+	for i := range files {
+		rest, ok := strings.CutPrefix(files[i].Name, dir)
+		if !ok || !MatchFile(&files[i], filter) {
+			continue
+		}
+		if j := strings.Index(rest, "/"); j >= 0 {
+			folder := dir + rest[:j+1]
+			if !seen[folder] {
+				seen[folder] = true
+				entries = append(entries, TableEntry{Folder: folder})
+			}
+			continue
+		}
+		entries = append(entries, TableEntry{File: &files[i]})
+	}
+	return entries
+}
+
+// downloadPartSize and downloadConcurrency shape ranged downloads: objects
+// larger than a part are fetched as parallel byte ranges.
+const (
+	downloadPartSize    = 8 << 20
+	downloadConcurrency = 8
+)
+
+// DownloadFile fetches file into file.Data, in parallel byte ranges when it
+// is large. progress, if set, is called with the bytes downloaded so far as
+// each range completes. Ranges are requested at file.Version, so an object
+// re-uploaded mid-download fails it instead of mixing parts. Cancelling ctx
+// aborts the download and leaves file.Data untouched.
+func DownloadFile(ctx context.Context, b bucket.Bucket, file *FileItem, progress func(done int64)) error {
+	if file.Size <= downloadPartSize {
+		body, err := b.Download(ctx, file.Name)
+		if err != nil {
+			return fmt.Errorf("failed to download object %s: %w", file.Name, err)
+		}
+		if progress != nil {
+			progress(int64(len(body)))
+		}
+		file.Data = body
+		return nil
+	}
+
+	body := make([]byte, file.Size)
+	var done atomic.Int64
+	g, ctx := errgroup.WithContext(ctx)
+	g.SetLimit(downloadConcurrency)
+	for offset := int64(0); offset < file.Size; offset += downloadPartSize {
+		length := min(downloadPartSize, file.Size-offset)
+		g.Go(func() error {
+			part, err := b.DownloadRange(ctx, file.Name, file.Version, offset, length)
+			if err != nil {
+				return fmt.Errorf("failed to download object %s at %d: %w", file.Name, offset, err)
+			}
+			if int64(len(part)) != length {
+				return fmt.Errorf("object %s changed while downloading: got %d bytes at %d, want %d",
+					file.Name, len(part), offset, length)
+			}
+			copy(body[offset:], part)
+			if progress != nil {
+				progress(done.Add(length))
+			}
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return err
 	}
 	file.Data = body
+	return nil
 }
 
-func GetMetricNames(db tsdb.DB, matcher string) []string {
+func GetMetricNames(db *tsdb.DB, matcher string) []string {
 	// Define a time range to cover the whole database
 	// Here, min and max times span the entire TSDB
 	minTime := db.Head().MinTime()
@@ -0,0 +1,58 @@
+package querier
+
+import (
+	"context"
+	"jcosta/ephemeral-prom/bucket"
+	"jcosta/ephemeral-prom/manifest"
+	"testing"
+)
+
+// memBucket lists objects without metadata, like S3.
+type memBucket map[string][]byte
+
+func (b memBucket) Name() string { return "mem://test" }
+
+func (b memBucket) Upload(ctx context.Context, key string, body []byte, opts bucket.UploadOptions) error {
+	b[key] = body
+	return nil
+}
+
+func (b memBucket) List(ctx context.Context, prefix string) ([]bucket.Object, error) {
+	var objects []bucket.Object
+	for key, body := range b {
+		objects = append(objects, bucket.Object{Key: key, Size: int64(len(body))})
+	}
+	return objects, nil
+}
+
+func (b memBucket) Download(ctx context.Context, key string) ([]byte, error) {
+	return b[key], nil
+}
+
+func (b memBucket) DownloadRange(ctx context.Context, key, version string, offset, length int64) ([]byte, error) {
+	return b[key][offset : offset+length], nil
+}
+
+func TestFilterFilesManifestFallback(t *testing.T) {
+	b := memBucket{}
+	for key, jobName := range map[string]string{"a.txt": "loadtest", "b.txt": "soak", "c.txt": ""} {
+		b[key] = []byte("up 1 1000\n")
+		if jobName == "" {
+			continue
+		}
+		m, err := manifest.Manifest{JobName: jobName, FormatVersion: "2"}.Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b[manifest.Key(key)] = m
+	}
+
+	files := GetFiles(b, "")
+	if len(files) != 3 {
+		t.Fatalf("GetFiles() returned %d files, want 3", len(files))
+	}
+	got := FilterFiles(files, "job_name=loadtest, format_version=2")
+	if len(got) != 1 || got[0].Name != "a.txt" {
+		t.Errorf("FilterFiles(job_name=loadtest) = %v, want a.txt", got)
+	}
+}
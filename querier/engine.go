@@ -0,0 +1,113 @@
+package querier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/storage"
+)
+
+// QueryLimits are the engine settings of a session. They start from the CLI
+// flags and can be changed with the lookback and limit commands.
+type QueryLimits struct {
+	LookbackDelta time.Duration
+	MaxSamples    int
+	Timeout       time.Duration
+	// Concurrency is the number of queries executing at once, the rest wait.
+	Concurrency int
+}
+
+var DefaultQueryLimits = QueryLimits{
+	LookbackDelta: 5 * time.Minute,
+	MaxSamples:    10000,
+	Timeout:       5 * time.Second,
+	Concurrency:   1,
+}
+
+// QueryEngine runs session queries with the session's current limits. The
+// promql.Engine is rebuilt whenever max samples or timeout change, lookback
+// is applied per query.
+type QueryEngine struct {
+	mu     sync.Mutex
+	limits QueryLimits
+	engine *promql.Engine
+	slots  chan struct{}
+}
+
+func NewQueryEngine() *QueryEngine {
+	return &QueryEngine{}
+}
+
+// engineFor returns an engine and a concurrency semaphore matching limits.
+func (e *QueryEngine) engineFor(limits QueryLimits) (*promql.Engine, chan struct{}) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.engine == nil || e.limits.MaxSamples != limits.MaxSamples || e.limits.Timeout != limits.Timeout {
+		e.engine = promql.NewEngine(promql.EngineOpts{
+			MaxSamples:    limits.MaxSamples,
+			Timeout:       limits.Timeout,
+			LookbackDelta: limits.LookbackDelta,
+		})
+	}
+	if e.slots == nil || e.limits.Concurrency != limits.Concurrency {
+		e.slots = make(chan struct{}, max(limits.Concurrency, 1))
+	}
+	e.limits = limits
+	return e.engine, e.slots
+}
+
+// Exec runs qs against q using the mode, times and limits in status. queued
+// is called if the query has to wait for a concurrency slot.
+func (e *QueryEngine) Exec(ctx context.Context, q storage.Queryable, status TerminalStatus, qs string, queued func()) *promql.Result {
+	limits := status.Limits()
+	engine, slots := e.engineFor(limits)
+
+	select {
+	case slots <- struct{}{}:
+	default:
+		if queued != nil {
+			queued()
+		}
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			return &promql.Result{Err: ctx.Err()}
+		}
+	}
+	defer func() { <-slots }()
+
+	opts := promql.NewPrometheusQueryOpts(false, limits.LookbackDelta)
+
+	var (
+		query promql.Query
+		err   error
+	)
+	if status.queryMode == "instant" {
+		query, err = engine.NewInstantQuery(ctx, q, opts, qs, status.instantTime)
+	} else {
+		query, err = engine.NewRangeQuery(ctx, q, opts, qs, status.intervalStart, status.intervalEnd, status.interval)
+	}
+	if err != nil {
+		return &promql.Result{Err: err}
+	}
+
+	return query.Exec(ctx)
+}
+
+// LimitHint explains which session limit a query error hit, if any.
+func LimitHint(err error, limits QueryLimits) string {
+	var tooManySamples promql.ErrTooManySamples
+	var timeout promql.ErrQueryTimeout
+	switch {
+	case errors.As(err, &tooManySamples):
+		return fmt.Sprintf("max samples limit (%d) hit, raise it with: limit samples !val", limits.MaxSamples)
+	case errors.As(err, &timeout):
+		return fmt.Sprintf("timeout (%s) hit, raise it with: limit timeout !val", limits.Timeout)
+	}
+	return ""
+}
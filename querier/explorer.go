@@ -0,0 +1,334 @@
+package querier
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/rivo/tview"
+)
+
+// labelStats is a label name or value of the explored metric with the
+// series and samples having it.
+type labelStats struct {
+	name    string
+	values  int // distinct values, for label names
+	series  int
+	samples int
+}
+
+// Explorer browses the loaded series: metric names with their series count,
+// then the label names of a metric with their number of values, the values
+// of a label, and the series having a value with their samples and time
+// coverage. / filters metric names, Enter moves right and on a series
+// prepares a query for it, Shift+Tab moves left.
+type Explorer struct {
+	*tview.Flex
+	filter     *tview.InputField
+	metrics    *tview.Table
+	labelNames *tview.Table
+	values     *tview.Table
+	series     *tview.Table
+
+	db               *tsdb.DB
+	minTime, maxTime int64 // of the storage, coverage is relative to it
+	seriesCounts     func() (map[string]int, error)
+	loaded           bool // the metric list was read from seriesCounts
+	counts           map[string]int
+	allMetrics       []string
+	names            []string // metric names matching the filter
+
+	all       []SeriesInfo // series of metric
+	labels    []labelStats
+	label     string
+	labelVals []labelStats
+	shown     []SeriesInfo // series of metric with the selected value
+
+	focus   func(p tview.Primitive)
+	onQuery func(query string)
+	onBack  func()
+	onError func(err error)
+}
+
+// NewExplorer returns an explorer over db, its metric list is read from
+// seriesCounts on first Load. focus moves the focus, onQuery receives the
+// query prepared for a series, onBack runs on Shift+Tab in the metric list
+// and onError reports failed storage lookups.
+func NewExplorer(db *tsdb.DB, seriesCounts func() (map[string]int, error), focus func(p tview.Primitive), onQuery func(query string), onBack func(), onError func(err error)) *Explorer {
+	e := &Explorer{
+		Flex:         tview.NewFlex().SetDirection(tview.FlexRow),
+		filter:       tview.NewInputField(),
+		metrics:      newExplorerTable(" metrics "),
+		labelNames:   newExplorerTable(" labels "),
+		values:       newExplorerTable(" values "),
+		series:       newExplorerTable(" series "),
+		db:           db,
+		seriesCounts: seriesCounts,
+		minTime:      db.Head().MinTime(),
+		maxTime:      db.Head().MaxTime(),
+		focus:        focus,
+		onQuery:      onQuery,
+		onBack:       onBack,
+		onError:      onError,
+	}
+
+	e.metrics.SetSelectedFunc(func(row, _ int) {
+		if row > 0 && row <= len(e.names) {
+			e.SelectMetric(e.names[row-1])
+			e.focus(e.labelNames)
+		}
+	})
+	e.labelNames.SetSelectionChangedFunc(func(row, _ int) {
+		if row > 0 && row <= len(e.labels) {
+			e.selectLabel(e.labels[row-1].name)
+		}
+	})
+	e.labelNames.SetSelectedFunc(func(int, int) { e.focus(e.values) })
+	e.values.SetSelectionChangedFunc(func(row, _ int) {
+		if row > 0 && row <= len(e.labelVals) {
+			e.selectValue(e.labelVals[row-1].name)
+		}
+	})
+	e.values.SetSelectedFunc(func(int, int) { e.focus(e.series) })
+	e.series.SetSelectedFunc(func(row, _ int) {
+		if row > 0 && row <= len(e.shown) {
+			e.onQuery(Selector(e.shown[row-1].Labels))
+		}
+	})
+
+	// Shift+Tab goes back one table, / filters metric names from anywhere.
+	back := map[*tview.Table]func(){
+		e.metrics:    e.onBack,
+		e.labelNames: func() { e.focus(e.metrics) },
+		e.values:     func() { e.focus(e.labelNames) },
+		e.series:     func() { e.focus(e.values) },
+	}
+	for table, goBack := range back {
+		table.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+			switch {
+			case event.Key() == tcell.KeyBacktab:
+				goBack()
+				return nil
+			case event.Rune() == '/':
+				e.focus(e.filter)
+				return nil
+			}
+			return event
+		})
+	}
+
+	e.filter.
+		SetLabel("/").
+		SetPlaceholder("filter metric names").
+		SetFieldWidth(0).
+		SetChangedFunc(func(string) { e.renderMetrics() }).
+		SetDoneFunc(func(tcell.Key) { e.focus(e.metrics) })
+
+	top := tview.NewFlex().
+		AddItem(e.metrics, 0, 2, true).
+		AddItem(e.labelNames, 0, 1, false).
+		AddItem(e.values, 0, 1, false)
+	e.AddItem(e.filter, 1, 0, false).
+		AddItem(top, 0, 1, true).
+		AddItem(e.series, 0, 1, false)
+
+	e.renderMetrics()
+	return e
+}
+
+func newExplorerTable(title string) *tview.Table {
+	t := tview.NewTable().
+		SetSelectable(true, false).
+		SetFixed(1, 0)
+	t.SetBorder(true).SetTitle(title)
+	return t
+}
+
+// Load reads the metric list the first time the explorer is shown, counting
+// series over a large storage takes a while.
+func (e *Explorer) Load() {
+	if e.loaded {
+		return
+	}
+	e.loaded = true
+	counts, err := e.seriesCounts()
+	if err != nil {
+		e.onError(fmt.Errorf("counting series: %w", err))
+	}
+	e.counts = counts
+	e.allMetrics = slices.Sorted(maps.Keys(counts))
+	e.renderMetrics()
+}
+
+// SelectMetric loads the series of metric and selects it in the metric list
+// when the filter shows it.
+func (e *Explorer) SelectMetric(metric string) {
+	e.Load()
+	if i := slices.Index(e.names, metric); i >= 0 {
+		e.metrics.Select(i+1, 0)
+	}
+
+	all, err := ListSeries(e.db, labels.MustNewMatcher(labels.MatchEqual, labels.MetricName, metric))
+	if err != nil {
+		e.onError(fmt.Errorf("listing series of %s: %w", metric, err))
+	}
+	e.all = all
+
+	byName := map[string]*labelStats{}
+	values := map[string]map[string]struct{}{}
+	for _, s := range e.all {
+		s.Labels.Range(func(l labels.Label) {
+			if l.Name == labels.MetricName {
+				return
+			}
+			st, ok := byName[l.Name]
+			if !ok {
+				st = &labelStats{name: l.Name}
+				byName[l.Name] = st
+				values[l.Name] = map[string]struct{}{}
+			}
+			st.series++
+			st.samples += s.Samples
+			values[l.Name][l.Value] = struct{}{}
+		})
+	}
+	e.labels = e.labels[:0]
+	for name, st := range byName {
+		st.values = len(values[name])
+		e.labels = append(e.labels, *st)
+	}
+	slices.SortFunc(e.labels, func(a, b labelStats) int { return strings.Compare(a.name, b.name) })
+
+	e.labelNames.Clear()
+	setHeader(e.labelNames, "label", "values", "series")
+	for i, st := range e.labels {
+		e.labelNames.SetCell(i+1, 0, tview.NewTableCell(tview.Escape(st.name)).SetExpansion(1))
+		e.labelNames.SetCell(i+1, 1, countCell(st.values))
+		e.labelNames.SetCell(i+1, 2, countCell(st.series))
+	}
+
+	if len(e.labels) == 0 {
+		// Only __name__, the one series is all there is
+		e.label = ""
+		e.labelVals = nil
+		e.values.Clear()
+		e.values.SetTitle(" values ")
+		e.showSeries(e.all)
+		return
+	}
+	// Selecting the first label shows its values and their series
+	e.labelNames.Select(1, 0).ScrollToBeginning()
+}
+
+func (e *Explorer) selectLabel(name string) {
+	e.label = name
+	byValue := map[string]*labelStats{}
+	for _, s := range e.all {
+		v := s.Labels.Get(name)
+		if v == "" {
+			continue
+		}
+		st, ok := byValue[v]
+		if !ok {
+			st = &labelStats{name: v}
+			byValue[v] = st
+		}
+		st.series++
+		st.samples += s.Samples
+	}
+	e.labelVals = e.labelVals[:0]
+	for _, st := range byValue {
+		e.labelVals = append(e.labelVals, *st)
+	}
+	// Highest cardinality first
+	slices.SortFunc(e.labelVals, func(a, b labelStats) int {
+		return cmp.Or(cmp.Compare(b.series, a.series), strings.Compare(a.name, b.name))
+	})
+
+	e.values.Clear()
+	setHeader(e.values, "value", "series", "samples")
+	for i, st := range e.labelVals {
+		e.values.SetCell(i+1, 0, tview.NewTableCell(tview.Escape(st.name)).SetExpansion(1))
+		e.values.SetCell(i+1, 1, countCell(st.series))
+		e.values.SetCell(i+1, 2, countCell(st.samples))
+	}
+	e.values.SetTitle(fmt.Sprintf(" values of %s ", name))
+	e.values.Select(1, 0).ScrollToBeginning()
+}
+
+func (e *Explorer) selectValue(value string) {
+	var shown []SeriesInfo
+	for _, s := range e.all {
+		if s.Labels.Get(e.label) == value {
+			shown = append(shown, s)
+		}
+	}
+	e.showSeries(shown)
+}
+
+func (e *Explorer) showSeries(shown []SeriesInfo) {
+	e.shown = shown
+	e.series.Clear()
+	setHeader(e.series, "series", "samples", "first", "last", "coverage")
+	span := max(e.maxTime-e.minTime, 1)
+	for i, s := range shown {
+		e.series.SetCell(i+1, 0, tview.NewTableCell(tview.Escape(Selector(s.Labels))).SetExpansion(1))
+		e.series.SetCell(i+1, 1, countCell(s.Samples))
+		e.series.SetCell(i+1, 2, tview.NewTableCell(e.offset(s.MinTime)).SetAlign(tview.AlignRight))
+		e.series.SetCell(i+1, 3, tview.NewTableCell(e.offset(s.MaxTime)).SetAlign(tview.AlignRight))
+		e.series.SetCell(i+1, 4, tview.NewTableCell(fmt.Sprintf("%.0f%%", float64(s.MaxTime-s.MinTime)/float64(span)*100)).
+			SetAlign(tview.AlignRight))
+	}
+	e.series.SetTitle(fmt.Sprintf(" series [blue](%d)[-], enter prepares a query ", len(shown)))
+	e.series.Select(1, 0).ScrollToBeginning()
+}
+
+func (e *Explorer) renderMetrics() {
+	e.names = e.names[:0]
+	for _, name := range e.allMetrics {
+		if strings.Contains(name, e.filter.GetText()) {
+			e.names = append(e.names, name)
+		}
+	}
+
+	e.metrics.Clear()
+	setHeader(e.metrics, "metric", "series")
+	for i, name := range e.names {
+		e.metrics.SetCell(i+1, 0, tview.NewTableCell(tview.Escape(name)).SetExpansion(1))
+		e.metrics.SetCell(i+1, 1, countCell(e.counts[name]))
+	}
+	e.metrics.SetTitle(fmt.Sprintf(" metrics [blue](%d/%d)[-], enter to explore ", len(e.names), len(e.allMetrics)))
+	e.metrics.Select(1, 0).ScrollToBeginning()
+}
+
+// offset renders t as its distance from the first sample of the storage,
+// the jobstart time anchor.
+func (e *Explorer) offset(t int64) string {
+	return "+" + (time.Duration(t-e.minTime) * time.Millisecond).String()
+}
+
+func setHeader(t *tview.Table, headers ...string) {
+	for i, h := range headers {
+		cell := tview.NewTableCell(h).
+			SetTextColor(tcell.ColorYellow).
+			SetAttributes(tcell.AttrBold).
+			SetSelectable(false)
+		if i > 0 {
+			cell.SetAlign(tview.AlignRight)
+		}
+		t.SetCell(0, i, cell)
+	}
+}
+
+func countCell(n int) *tview.TableCell {
+	return tview.NewTableCell(strconv.Itoa(n)).
+		SetTextColor(tcell.ColorGreen).
+		SetAlign(tview.AlignRight)
+}
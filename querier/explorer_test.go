@@ -0,0 +1,44 @@
+package querier
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/rivo/tview"
+)
+
+// TestExplorerLoad checks that explorers count series on first use only,
+// once for all of them.
+func TestExplorerLoad(t *testing.T) {
+	ts := openTestStorage(t, 0)
+	ParseSequence(ts.DB, strings.NewReader("up{i=\"1\"} 1 1000\nup{i=\"2\"} 1 1000\nfoo 1 1000\n"), LoadOptions{})
+
+	calls := 0
+	seriesCounts := sync.OnceValues(func() (map[string]int, error) {
+		calls++
+		return MetricSeriesCounts(ts.DB)
+	})
+	newExplorer := func() *Explorer {
+		return NewExplorer(ts.DB, seriesCounts, func(tview.Primitive) {}, func(string) {}, func() {},
+			func(err error) { t.Error(err) })
+	}
+	a, b := newExplorer(), newExplorer()
+	if calls != 0 {
+		t.Fatalf("series counted %d times before any explore", calls)
+	}
+
+	a.Load()
+	b.SelectMetric("up")
+	if calls != 1 {
+		t.Errorf("series counted %d times, want once", calls)
+	}
+	for _, e := range []*Explorer{a, b} {
+		if len(e.allMetrics) != 2 || e.counts["up"] != 2 {
+			t.Errorf("metrics %v, counts %v, want foo and up with 2 series", e.allMetrics, e.counts)
+		}
+	}
+	if len(b.all) != 2 {
+		t.Errorf("SelectMetric(up) listed %d series, want 2", len(b.all))
+	}
+}
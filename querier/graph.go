@@ -0,0 +1,324 @@
+package querier
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/rivo/tview"
+)
+
+// graphColors cycles through the series of a graph.
+var graphColors = []tcell.Color{
+	tcell.ColorGreen,
+	tcell.ColorOrange,
+	tcell.ColorDodgerBlue,
+	tcell.ColorHotPink,
+	tcell.ColorYellow,
+	tcell.ColorMediumPurple,
+	tcell.ColorAqua,
+	tcell.ColorRed,
+}
+
+// brailleBits maps the dot at column x (0-1) and row y (0-3) of a braille
+// cell to its bit in the U+2800 block.
+var brailleBits = [2][4]rune{
+	{0x01, 0x02, 0x04, 0x40},
+	{0x08, 0x10, 0x20, 0x80},
+}
+
+type graphSeries struct {
+	name   string
+	points []promql.FPoint
+}
+
+// Graph renders range query results as braille line charts, with a Y axis
+// scaled to the data, a time axis ticked on multiples of the query step and
+// a legend.
+type Graph struct {
+	*tview.Box
+	series     []graphSeries
+	start, end int64 // ms
+	step       time.Duration
+	unit       string
+}
+
+func NewGraph() *Graph {
+	g := &Graph{Box: tview.NewBox()}
+	g.SetBorder(true).SetTitle(" graph ")
+	return g
+}
+
+// SetData replaces the graphed series with the float samples of m, plotted
+// over start to end.
+func (g *Graph) SetData(m promql.Matrix, start, end time.Time, step time.Duration) {
+	g.series = g.series[:0]
+	for _, s := range m {
+		if len(s.Floats) == 0 {
+			continue
+		}
+		g.series = append(g.series, graphSeries{
+			name:   s.Metric.String(),
+			points: append([]promql.FPoint(nil), s.Floats...),
+		})
+	}
+	g.start, g.end = start.UnixMilli(), end.UnixMilli()
+	g.step = step
+	g.unit = matrixUnit(m)
+}
+
+// Len returns the number of series graphed.
+func (g *Graph) Len() int {
+	return len(g.series)
+}
+
+// matrixUnit guesses the unit of m from the Prometheus naming conventions of
+// its metric names, when they all agree.
+func matrixUnit(m promql.Matrix) string {
+	unit := ""
+	for i, s := range m {
+		name := strings.TrimSuffix(s.Metric.Get("__name__"), "_total")
+		u := ""
+		switch {
+		case strings.HasSuffix(name, "_bytes"):
+			u = "bytes"
+		case strings.HasSuffix(name, "_seconds"):
+			u = "seconds"
+		}
+		if i > 0 && u != unit {
+			return ""
+		}
+		unit = u
+	}
+	return unit
+}
+
+// FormatValue renders v compactly in unit: bytes use binary prefixes,
+// seconds switch to ms/µs/ns, anything else gets SI prefixes.
+func FormatValue(v float64, unit string) string {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return fmt.Sprint(v)
+	}
+
+	abs := math.Abs(v)
+	switch unit {
+	case "bytes":
+		prefixes := []string{"B", "KiB", "MiB", "GiB", "TiB", "PiB"}
+		i := 0
+		for abs >= 1024 && i < len(prefixes)-1 {
+			v /= 1024
+			abs /= 1024
+			i++
+		}
+		return fmt.Sprintf("%.4g%s", v, prefixes[i])
+	case "seconds":
+		switch {
+		case abs == 0 || abs >= 1:
+			return fmt.Sprintf("%.4gs", v)
+		case abs >= 1e-3:
+			return fmt.Sprintf("%.4gms", v*1e3)
+		case abs >= 1e-6:
+			return fmt.Sprintf("%.4gµs", v*1e6)
+		}
+		return fmt.Sprintf("%.4gns", v*1e9)
+	}
+
+	prefixes := []struct {
+		scale  float64
+		symbol string
+	}{{1e12, "T"}, {1e9, "G"}, {1e6, "M"}, {1e3, "k"}, {1, ""}, {1e-3, "m"}, {1e-6, "µ"}}
+	if abs == 0 {
+		return "0"
+	}
+	for _, p := range prefixes {
+		if abs >= p.scale {
+			return fmt.Sprintf("%.4g%s", v/p.scale, p.symbol)
+		}
+	}
+	return fmt.Sprintf("%.4g", v)
+}
+
+// formatTick renders a time axis label. Aligned jobs start at t=0, so small
+// timestamps are shown as offsets instead of dates.
+func (g *Graph) formatTick(t int64) string {
+	if g.start >= 0 && g.end < int64(365*24*time.Hour/time.Millisecond) {
+		return "+" + (time.Duration(t) * time.Millisecond).String()
+	}
+	tm := time.UnixMilli(t)
+	switch {
+	case g.end-g.start >= int64(24*time.Hour/time.Millisecond):
+		return tm.Format("01-02 15:04")
+	case g.step < time.Minute:
+		return tm.Format("15:04:05")
+	}
+	return tm.Format("15:04")
+}
+
+func (g *Graph) Draw(screen tcell.Screen) {
+	g.Box.DrawForSubclass(screen, g)
+	x, y, width, height := g.GetInnerRect()
+	if len(g.series) == 0 {
+		tview.Print(screen, "[grey]run a range query to graph it", x, y, width, tview.AlignLeft, tcell.ColorGrey)
+		return
+	}
+
+	// Y range over every finite sample, padded when flat.
+	minV, maxV := math.Inf(1), math.Inf(-1)
+	for _, s := range g.series {
+		for _, p := range s.points {
+			if math.IsNaN(p.F) || math.IsInf(p.F, 0) {
+				continue
+			}
+			minV = min(minV, p.F)
+			maxV = max(maxV, p.F)
+		}
+	}
+	if math.IsInf(minV, 1) {
+		minV, maxV = 0, 1
+	}
+	if minV == maxV {
+		pad := math.Max(math.Abs(minV)*0.1, 1)
+		minV, maxV = minV-pad, maxV+pad
+	}
+
+	legendRows := min(len(g.series), max(1, height/4))
+	plotH := height - 1 - legendRows
+	dotsH := plotH * 4
+
+	// Y axis labels on the first and last rows and every fourth in between.
+	yLabels := map[int]string{plotH - 1: FormatValue(minV, g.unit)}
+	for r := 0; plotH-1-r >= 2; r += 4 {
+		yLabels[r] = FormatValue(maxV-float64(r*4)/float64(dotsH-1)*(maxV-minV), g.unit)
+	}
+	labelW := 0
+	for _, l := range yLabels {
+		labelW = max(labelW, utf8.RuneCountInString(l)+1)
+	}
+
+	plotW := width - labelW
+	if plotH < 2 || plotW < 8 {
+		tview.Print(screen, "[grey]too small to graph", x, y, width, tview.AlignLeft, tcell.ColorGrey)
+		return
+	}
+	plotX := x + labelW
+	dotsW := plotW * 2
+	span := max(g.end-g.start, 1)
+
+	// Plot every series into braille cells, the last series drawn on a
+	// cell gives it its color.
+	cells := make([][]rune, plotH)
+	colors := make([][]tcell.Color, plotH)
+	for r := range cells {
+		cells[r] = make([]rune, plotW)
+		colors[r] = make([]tcell.Color, plotW)
+	}
+	setDot := func(dx, dy int, color tcell.Color) {
+		if dx < 0 || dy < 0 || dx >= dotsW || dy >= dotsH {
+			return
+		}
+		cells[dy/4][dx/2] |= brailleBits[dx%2][dy%4]
+		colors[dy/4][dx/2] = color
+	}
+	toDot := func(p promql.FPoint) (int, int) {
+		dx := int(float64(p.T-g.start) / float64(span) * float64(dotsW-1))
+		dy := int((maxV - p.F) / (maxV - minV) * float64(dotsH-1))
+		return dx, dy
+	}
+	maxGap := 2 * g.step.Milliseconds()
+	for i, s := range g.series {
+		color := graphColors[i%len(graphColors)]
+		for j, p := range s.points {
+			if math.IsNaN(p.F) || math.IsInf(p.F, 0) {
+				continue
+			}
+			dx, dy := toDot(p)
+			// A gap or a non-finite point before starts a new segment.
+			if j == 0 || (maxGap > 0 && p.T-s.points[j-1].T > maxGap) ||
+				math.IsNaN(s.points[j-1].F) || math.IsInf(s.points[j-1].F, 0) {
+				setDot(dx, dy, color)
+				continue
+			}
+			px, py := toDot(s.points[j-1])
+			drawLine(px, py, dx, dy, func(lx, ly int) { setDot(lx, ly, color) })
+		}
+	}
+
+	for r := range cells {
+		for c, bits := range cells[r] {
+			ch := '⠀'
+			if bits != 0 {
+				ch = 0x2800 + bits
+			}
+			screen.SetContent(plotX+c, y+r, ch, nil, tcell.StyleDefault.Foreground(colors[r][c]))
+		}
+	}
+
+	for r, l := range yLabels {
+		tview.Print(screen, l, x, y+r, labelW-1, tview.AlignRight, tcell.ColorGrey)
+	}
+
+	// Time axis ticks on multiples of the step, spaced to fit their labels.
+	tickW := len(g.formatTick(g.end)) + 2
+	stepMs := max(g.step.Milliseconds(), 1)
+	steps := max(span/stepMs, 1)
+	every := max((steps*int64(tickW)+int64(plotW)-1)/int64(plotW), 1)
+	for t := g.start; t <= g.end; t += every * stepMs {
+		col := int(float64(t-g.start) / float64(span) * float64(plotW-1))
+		if col+tickW-2 > plotW {
+			break
+		}
+		screen.SetContent(plotX+col, y+plotH, '╵', nil, tcell.StyleDefault.Foreground(tcell.ColorGrey))
+		tview.Print(screen, g.formatTick(t), plotX+col+1, y+plotH, tickW, tview.AlignLeft, tcell.ColorGrey)
+	}
+
+	// Legend
+	for i := 0; i < legendRows; i++ {
+		row := y + plotH + 1 + i
+		if i == legendRows-1 && legendRows < len(g.series) {
+			tview.Print(screen, fmt.Sprintf("[grey]... %d more series", len(g.series)-i), x, row, width, tview.AlignLeft, tcell.ColorGrey)
+			break
+		}
+		color := graphColors[i%len(graphColors)]
+		screen.SetContent(x, row, '■', nil, tcell.StyleDefault.Foreground(color))
+		tview.Print(screen, tview.Escape(g.series[i].name), x+2, row, width-2, tview.AlignLeft, tcell.ColorWhite)
+	}
+}
+
+// drawLine calls plot for every dot between two dots (Bresenham).
+func drawLine(x0, y0, x1, y1 int, plot func(x, y int)) {
+	dx, dy := abs(x1-x0), -abs(y1-y0)
+	sx, sy := 1, 1
+	if x0 > x1 {
+		sx = -1
+	}
+	if y0 > y1 {
+		sy = -1
+	}
+	e := dx + dy
+	for {
+		plot(x0, y0)
+		if x0 == x1 && y0 == y1 {
+			return
+		}
+		e2 := 2 * e
+		if e2 >= dy {
+			e += dy
+			x0 += sx
+		}
+		if e2 <= dx {
+			e += dx
+			y0 += sy
+		}
+	}
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
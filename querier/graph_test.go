@@ -0,0 +1,65 @@
+package querier
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql"
+)
+
+// TestGraphNonFinite checks that ±Inf and NaN samples break the line
+// instead of being plotted or joined.
+func TestGraphNonFinite(t *testing.T) {
+	screen := tcell.NewSimulationScreen("")
+	if err := screen.Init(); err != nil {
+		t.Fatal(err)
+	}
+	defer screen.Fini()
+	screen.SetSize(80, 20)
+
+	start := time.UnixMilli(0)
+	var floats []promql.FPoint
+	for i, v := range []float64{1, math.Inf(1), 2, math.Inf(-1), 3, math.NaN(), 4} {
+		floats = append(floats, promql.FPoint{T: int64(i) * 1000, F: v})
+	}
+	g := NewGraph()
+	g.SetRect(0, 0, 80, 20)
+	g.SetData(promql.Matrix{{Metric: labels.FromStrings("__name__", "up"), Floats: floats}},
+		start, start.Add(6*time.Second), time.Second)
+
+	done := make(chan struct{})
+	go func() {
+		g.Draw(screen)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Draw didn't return")
+	}
+
+	screen.Show()
+
+	// The four finite points are plotted apart, nothing joins them.
+	cells, width, _ := screen.GetContents()
+	dots := 0
+	for _, c := range cells[:18*width] {
+		if len(c.Runes) > 0 && c.Runes[0] > 0x2800 && c.Runes[0] <= 0x28ff {
+			dots += bitCount(c.Runes[0] - 0x2800)
+		}
+	}
+	if dots != 4 {
+		t.Errorf("graph has %d dots, want 4", dots)
+	}
+}
+
+func bitCount(r rune) int {
+	n := 0
+	for ; r > 0; r >>= 1 {
+		n += int(r & 1)
+	}
+	return n
+}
@@ -0,0 +1,236 @@
+package querier
+
+import (
+	"errors"
+	"slices"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/rivo/tview"
+)
+
+// Colors of the query input tokens, chosen to read on the input's blue
+// background.
+var (
+	commandColor  = tcell.ColorOrange
+	metricColor   = tcell.ColorWhite
+	labelColor    = tcell.ColorLightCyan
+	functionColor = tcell.ColorYellow
+	keywordColor  = tcell.ColorPink
+	stringColor   = tcell.ColorLightGreen
+	numberColor   = tcell.ColorAqua
+)
+
+// QueryInput is the query input line. It highlights the PromQL being typed
+// and validates it on every change: the row above the text marks where a
+// parse error is with a caret and its message, so it shows before the query
+// runs. Session commands are highlighted but not parsed.
+type QueryInput struct {
+	*tview.InputField
+}
+
+// NewQueryInput returns an empty query input. It needs two rows, the first
+// one holds parse errors.
+func NewQueryInput() *QueryInput {
+	return &QueryInput{InputField: tview.NewInputField()}
+}
+
+// ParseError returns the first parse error of the query in the input, nil
+// when it parses or is a session command.
+func (q *QueryInput) ParseError() *parser.ParseErr {
+	return QueryParseError(q.GetText())
+}
+
+// QueryParseError returns the first parse error of text, nil when it parses,
+// is empty or is a session command.
+func QueryParseError(text string) *parser.ParseErr {
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		return nil
+	}
+	if _, ok := SessionCommands[fields[0]]; ok {
+		return nil
+	}
+	_, err := parser.ParseExpr(text)
+	var errs parser.ParseErrors
+	if errors.As(err, &errs) && len(errs) > 0 {
+		return &errs[0]
+	}
+	return nil
+}
+
+// Highlight returns the color of every byte of text, the default color for
+// operators, punctuation and spaces.
+func Highlight(text string) []tcell.Color {
+	colors := make([]tcell.Color, len(text))
+	paint := func(start, end int, color tcell.Color) {
+		for i := start; i < min(end, len(colors)); i++ {
+			colors[i] = color
+		}
+	}
+
+	if fields := strings.Fields(text); len(fields) > 0 {
+		if _, ok := SessionCommands[fields[0]]; ok {
+			start := strings.Index(text, fields[0])
+			paint(start, start+len(fields[0]), commandColor)
+			return colors
+		}
+	}
+
+	var items []parser.Item
+	lexer := parser.Lex(text)
+	for {
+		var item parser.Item
+		lexer.NextItem(&item)
+		if item.Typ == parser.EOF || item.Typ == parser.ERROR {
+			break
+		}
+		items = append(items, item)
+	}
+
+	inBraces := false
+	groupingDepth := 0 // > 0 inside by (...) and the like
+	depth := 0
+	for i, item := range items {
+		start := int(item.Pos)
+		end := start + len(item.Val)
+		next := parser.ItemType(0)
+		if i+1 < len(items) {
+			next = items[i+1].Typ
+		}
+
+		switch {
+		case item.Typ == parser.LEFT_BRACE:
+			inBraces = true
+		case item.Typ == parser.RIGHT_BRACE:
+			inBraces = false
+		case item.Typ == parser.LEFT_PAREN:
+			depth++
+			if i > 0 && slices.Contains(grouping, items[i-1].Val) && groupingDepth == 0 {
+				groupingDepth = depth
+			}
+		case item.Typ == parser.RIGHT_PAREN:
+			if depth == groupingDepth {
+				groupingDepth = 0
+			}
+			depth--
+		case item.Typ == parser.STRING:
+			paint(start, end, stringColor)
+		case item.Typ == parser.NUMBER, item.Typ == parser.DURATION:
+			paint(start, end, numberColor)
+		case item.Typ.IsAggregator():
+			paint(start, end, functionColor)
+		case item.Typ.IsKeyword():
+			paint(start, end, keywordColor)
+		case item.Typ == parser.IDENTIFIER || item.Typ == parser.METRIC_IDENTIFIER:
+			switch _, isFunction := parser.Functions[item.Val]; {
+			case inBraces || groupingDepth > 0:
+				paint(start, end, labelColor)
+			case isFunction && next == parser.LEFT_PAREN:
+				paint(start, end, functionColor)
+			default:
+				paint(start, end, metricColor)
+			}
+		}
+	}
+	return colors
+}
+
+func (q *QueryInput) Draw(screen tcell.Screen) {
+	x, y, width, height := q.GetRect()
+	if height < 2 {
+		q.InputField.Draw(screen)
+		return
+	}
+
+	// The text goes on the last row, the row above is for errors.
+	for col := x; col < x+width; col++ {
+		screen.SetContent(col, y, ' ', nil, tcell.StyleDefault)
+	}
+	q.SetRect(x, y+height-1, width, 1)
+	q.InputField.Draw(screen)
+
+	text := q.GetText()
+	if text == "" {
+		return
+	}
+	fieldX := x + tview.TaggedStringWidth(q.GetLabel())
+	row := y + height - 1
+	cols, offset := visibleText(screen, text, fieldX, x+width, row)
+	if cols == nil {
+		return
+	}
+
+	// Recolor the visible text, underlining the error range.
+	parseErr := q.ParseError()
+	colors := Highlight(text)
+	for i, col := range cols {
+		pos := offset[i]
+		mainc, combc, style, _ := screen.GetContent(col, row)
+		if colors[pos] != 0 {
+			style = style.Foreground(colors[pos])
+		}
+		if parseErr != nil && pos >= int(parseErr.PositionRange.Start) && pos < int(parseErr.PositionRange.End) {
+			style = style.Underline(true)
+		}
+		screen.SetContent(col, row, mainc, combc, style)
+	}
+	if parseErr == nil {
+		return
+	}
+
+	// Caret under the error start, past the text when the query ends early.
+	caret := -1
+	for i, col := range cols {
+		if offset[i] >= int(parseErr.PositionRange.Start) {
+			caret = col
+			break
+		}
+	}
+	if caret < 0 {
+		_, _, _, w := screen.GetContent(cols[len(cols)-1], row)
+		caret = min(cols[len(cols)-1]+max(w, 1), x+width-1)
+	}
+	msg := parseErr.Err.Error()
+	screen.SetContent(caret, y+height-2, '^', nil, tcell.StyleDefault.Foreground(tcell.ColorRed).Bold(true))
+
+	// Right of the caret unless it only fits on the left.
+	right := x + width - caret - 2
+	if msgWidth := tview.TaggedStringWidth(tview.Escape(msg)); msgWidth <= right || right >= caret-x-1 {
+		tview.Print(screen, tview.Escape(msg), caret+2, y+height-2, x+width-caret-2, tview.AlignLeft, tcell.ColorRed)
+	} else {
+		tview.Print(screen, tview.Escape(msg), x, y+height-2, caret-x-1, tview.AlignRight, tcell.ColorRed)
+	}
+}
+
+// visibleText finds the part of text the input field shows on row between
+// columns from and to, scrolled or not. It returns the column of every
+// visible rune and its byte offset in text, nil columns when the screen
+// doesn't show text.
+func visibleText(screen tcell.Screen, text string, from, to, row int) (cols, offsets []int) {
+	var shown []rune
+	var shownCols []int
+	for col := from; col < to; {
+		mainc, _, _, w := screen.GetContent(col, row)
+		shown = append(shown, mainc)
+		shownCols = append(shownCols, col)
+		col += max(w, 1)
+	}
+
+	var runes []rune
+	var runeOffsets []int
+	for i, r := range text {
+		runes = append(runes, r)
+		runeOffsets = append(runeOffsets, i)
+	}
+
+	// The field scrolls by whole runes, find the first one shown.
+	for start := range runes {
+		n := min(len(shown), len(runes)-start)
+		if slices.Equal(shown[:n], runes[start:start+n]) && strings.TrimSpace(string(shown[n:])) == "" {
+			return shownCols[:n], runeOffsets[start : start+n]
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,119 @@
+package querier
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// maxHistory is the number of entries kept in the history file.
+const maxHistory = 1000
+
+// historyListed is the number of entries the history command lists.
+const historyListed = 20
+
+// History is the list of commands and queries run in past sessions, oldest
+// first, stored one per line in a file.
+type History struct {
+	path    string
+	mu      sync.Mutex
+	entries []string
+}
+
+// DefaultHistoryPath returns ~/.eph_history.
+func DefaultHistoryPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".eph_history")
+}
+
+// LoadHistory reads the history file at path, a missing file is an empty
+// history. An empty path keeps the history in memory only.
+func LoadHistory(path string) (*History, error) {
+	h := &History{path: path}
+	if path == "" {
+		return h, nil
+	}
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return h, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		if line := scanner.Text(); line != "" {
+			h.entries = append(h.entries, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	// Compact the file once it holds twice the entries kept.
+	if len(h.entries) > 2*maxHistory {
+		h.entries = h.entries[len(h.entries)-maxHistory:]
+		if err := os.WriteFile(path, []byte(strings.Join(h.entries, "\n")+"\n"), 0o600); err != nil {
+			return nil, err
+		}
+	}
+	return h, nil
+}
+
+// Entries returns the entries, oldest first.
+func (h *History) Entries() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.entries
+}
+
+// Add appends entry to the history and its file, unless it repeats the last
+// entry.
+func (h *History) Add(entry string) error {
+	entry = strings.TrimSpace(entry)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if entry == "" || len(h.entries) > 0 && h.entries[len(h.entries)-1] == entry {
+		return nil
+	}
+	h.entries = append(h.entries, entry)
+	if len(h.entries) > maxHistory {
+		h.entries = h.entries[len(h.entries)-maxHistory:]
+	}
+
+	if h.path == "" {
+		return nil
+	}
+	f, err := os.OpenFile(h.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(f, entry); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Search returns the index of the newest entry before index before that
+// contains term.
+func (h *History) Search(term string, before int) (int, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i := min(before, len(h.entries)) - 1; i >= 0; i-- {
+		if strings.Contains(h.entries[i], term) {
+			return i, true
+		}
+	}
+	return 0, false
+}
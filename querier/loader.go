@@ -0,0 +1,321 @@
+package querier
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"jcosta/ephemeral-prom/compression"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb"
+)
+
+// SeriesReport counts the samples of one series that didn't load cleanly.
+type SeriesReport struct {
+	// OutOfOrder samples were older than the newest sample of the series but
+	// within the out-of-order window of the newest sample loaded, of any
+	// series, so they were kept.
+	OutOfOrder int
+	// Duplicate samples repeated the newest timestamp and value of the series
+	// and were dropped.
+	Duplicate int
+	// Conflicting samples repeated the newest timestamp of the series with a
+	// different value. The first value read is kept.
+	Conflicting int
+	// Rejected samples were out of order by more than the window, measured
+	// from the newest sample loaded, or refused by the storage.
+	Rejected int
+}
+
+// LoadReport summarises a load.
+type LoadReport struct {
+	Appended int
+	// Scrapes counts the scrape records read, 0 for files without record
+	// headers.
+	Scrapes int
+	Series  map[string]*SeriesReport
+	// NoTimestamp counts samples skipped for lacking a timestamp.
+	NoTimestamp int
+	// ParseErrors counts malformed lines, the first few are kept in Errors.
+	ParseErrors int
+	Errors      []string
+}
+
+func (r *LoadReport) addParseError(err error) {
+	r.ParseErrors++
+	if len(r.Errors) < maxReportedParseErrors {
+		r.Errors = append(r.Errors, err.Error())
+	}
+}
+
+func (r *LoadReport) series(lset labels.Labels) *SeriesReport {
+	if r.Series == nil {
+		r.Series = map[string]*SeriesReport{}
+	}
+	key := lset.String()
+	s, ok := r.Series[key]
+	if !ok {
+		s = &SeriesReport{}
+		r.Series[key] = s
+	}
+	return s
+}
+
+// Merge adds other's counts to r.
+func (r *LoadReport) Merge(other LoadReport) {
+	r.Appended += other.Appended
+	r.Scrapes += other.Scrapes
+	r.NoTimestamp += other.NoTimestamp
+	r.ParseErrors += other.ParseErrors
+	for _, e := range other.Errors {
+		if len(r.Errors) < maxReportedParseErrors {
+			r.Errors = append(r.Errors, e)
+		}
+	}
+	for key, o := range other.Series {
+		if r.Series == nil {
+			r.Series = map[string]*SeriesReport{}
+		}
+		s, ok := r.Series[key]
+		if !ok {
+			s = &SeriesReport{}
+			r.Series[key] = s
+		}
+		s.OutOfOrder += o.OutOfOrder
+		s.Duplicate += o.Duplicate
+		s.Conflicting += o.Conflicting
+		s.Rejected += o.Rejected
+	}
+}
+
+// Summary renders the report for the output view, listing at most top series.
+func (r LoadReport) Summary(top int) string {
+	var outOfOrder, duplicate, conflicting, rejected int
+	for _, s := range r.Series {
+		outOfOrder += s.OutOfOrder
+		duplicate += s.Duplicate
+		conflicting += s.Conflicting
+		rejected += s.Rejected
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "loaded %d samples", r.Appended)
+	if r.Scrapes > 0 {
+		fmt.Fprintf(&sb, " from %d scrapes", r.Scrapes)
+	}
+	if r.NoTimestamp > 0 {
+		fmt.Fprintf(&sb, ", skipped %d without timestamp", r.NoTimestamp)
+	}
+	if r.ParseErrors > 0 {
+		fmt.Fprintf(&sb, ", %d malformed lines", r.ParseErrors)
+	}
+	if len(r.Series) > 0 {
+		fmt.Fprintf(&sb, ", %d out of order (kept), %d duplicate, %d conflicting, %d rejected in %d series",
+			outOfOrder, duplicate, conflicting, rejected, len(r.Series))
+	}
+	for _, e := range r.Errors {
+		fmt.Fprintf(&sb, "\n  %s", e)
+	}
+
+	keys := make([]string, 0, len(r.Series))
+	for k := range r.Series {
+		keys = append(keys, k)
+	}
+	total := func(k string) int {
+		s := r.Series[k]
+		return s.OutOfOrder + s.Duplicate + s.Conflicting + s.Rejected
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if total(keys[i]) != total(keys[j]) {
+			return total(keys[i]) > total(keys[j])
+		}
+		return keys[i] < keys[j]
+	})
+
+	for i, k := range keys {
+		if i == top {
+			fmt.Fprintf(&sb, "\n  ... %d more series", len(keys)-top)
+			break
+		}
+		s := r.Series[k]
+		fmt.Fprintf(&sb, "\n  %s: %d out of order, %d duplicate, %d conflicting, %d rejected",
+			k, s.OutOfOrder, s.Duplicate, s.Conflicting, s.Rejected)
+	}
+	return sb.String()
+}
+
+// commitSamples is the number of samples appended per storage transaction.
+const commitSamples = 100_000
+
+type sample struct {
+	lset labels.Labels
+	t    int64
+	v    float64
+}
+
+// newestSample is the latest sample appended to a series.
+type newestSample struct {
+	t int64
+	v float64
+}
+
+// loader appends samples while tracking the newest sample of every series,
+// so out-of-order, duplicate and conflicting samples are counted instead of
+// being silently dropped or overwritten by the storage on commit.
+//
+// Samples are committed every commitSamples, the head appender holds the
+// pending ones in memory.
+//
+// The TSDB keeps an out-of-order sample when it is within the window of the
+// head's max time as of the appender's creation, and silently drops it on
+// commit otherwise. The loader applies the same rule and renews the appender
+// before keeping one, so both agree on the max time.
+type loader struct {
+	db       *tsdb.DB
+	app      storage.Appender
+	headMaxt int64 // max time of the head when app was created
+	maxt     int64 // newest sample appended, committed or not
+	pending  int   // samples appended since the last commit
+	window   int64
+	newest   map[uint64]newestSample
+	sorted   []sample
+	sort     bool
+	report   LoadReport
+	err      error
+}
+
+func newLoader(db *tsdb.DB, opts LoadOptions) *loader {
+	maxt := db.Head().MaxTime()
+	return &loader{
+		db:       db,
+		app:      db.Appender(context.Background()),
+		headMaxt: maxt,
+		maxt:     maxt,
+		window:   opts.OutOfOrderWindow.Milliseconds(),
+		newest:   map[uint64]newestSample{},
+		sort:     opts.Sort,
+	}
+}
+
+// renew commits the pending samples and starts a new appender.
+func (l *loader) renew() error {
+	if err := l.app.Commit(); err != nil {
+		return err
+	}
+	l.app = l.db.Appender(context.Background())
+	l.headMaxt = l.db.Head().MaxTime()
+	l.pending = 0
+	return nil
+}
+
+func (l *loader) Append(lset labels.Labels, t int64, v float64) {
+	if l.sort {
+		l.sorted = append(l.sorted, sample{lset: lset, t: t, v: v})
+		return
+	}
+	l.append(lset, t, v)
+}
+
+func (l *loader) append(lset labels.Labels, t int64, v float64) {
+	if l.err != nil {
+		return
+	}
+	hash := lset.Hash()
+	newest, seen := l.newest[hash]
+	switch {
+	case !seen || t > newest.t:
+		l.newest[hash] = newestSample{t: t, v: v}
+	case t == newest.t && math.Float64bits(v) == math.Float64bits(newest.v):
+		l.report.series(lset).Duplicate++
+		return
+	case t == newest.t:
+		l.report.series(lset).Conflicting++
+		return
+	case l.window == 0 || l.maxt-t > l.window:
+		l.report.series(lset).Rejected++
+		return
+	default:
+		if l.headMaxt != l.maxt {
+			if l.err = l.renew(); l.err != nil {
+				return
+			}
+		}
+		l.report.series(lset).OutOfOrder++
+	}
+
+	if _, err := l.app.Append(0, lset, t, v); err != nil {
+		l.report.series(lset).Rejected++
+		return
+	}
+	l.maxt = max(l.maxt, t)
+	l.report.Appended++
+	if l.pending++; l.pending >= commitSamples {
+		l.err = l.renew()
+	}
+}
+
+// Commit flushes the sort buffer, if any, and commits the appender.
+func (l *loader) Commit() (LoadReport, error) {
+	if l.sort {
+		slices.SortStableFunc(l.sorted, func(a, b sample) int {
+			if c := labels.Compare(a.lset, b.lset); c != 0 {
+				return c
+			}
+			return cmp.Compare(a.t, b.t)
+		})
+		for _, s := range l.sorted {
+			l.append(s.lset, s.t, s.v)
+		}
+		l.sorted = nil
+	}
+	if l.err != nil {
+		l.app.Rollback()
+		return l.report, l.err
+	}
+	return l.report, l.app.Commit()
+}
+
+// LoadFiles appends every file to ts, labelling samples with eph_job when
+// there is more than one file and shifting them to their anchor when opts
+// aligns them. Compressed files are decompressed first. progress is called
+// with the index of the file being loaded, the bytes read from it so far and
+// its decompressed size. It returns the merged report and the jobs the align
+// metric wasn't found in.
+func LoadFiles(ts *Storage, files []*FileItem, opts ViewOptions, progress func(file int, read, size int64)) (LoadReport, []string) {
+	var notAligned []string
+	var report LoadReport
+	jobLabels := JobLabels(files)
+	for i, file := range files {
+		data, err := compression.Decompress(file.Data)
+		if err != nil {
+			report.addParseError(fmt.Errorf("%s: decompressing: %w", jobLabels[i], err))
+			continue
+		}
+
+		loadOpts := LoadOptions{
+			OutOfOrderWindow: opts.Storage.OutOfOrderWindow,
+			Sort:             opts.Sort,
+		}
+		if progress != nil {
+			loadOpts.Progress = func(read int64) { progress(i, read, int64(len(data))) }
+		}
+		if len(files) > 1 {
+			loadOpts.JobLabel = jobLabels[i]
+		}
+		if opts.Align {
+			anchor, ok := JobAnchor(data, opts.AlignMetric)
+			if ok {
+				loadOpts.TimeOffset = anchor
+			} else {
+				notAligned = append(notAligned, jobLabels[i])
+			}
+		}
+		report.Merge(ParseSequenceString(ts.DB, data, loadOpts))
+	}
+	return report, notAligned
+}
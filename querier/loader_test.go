@@ -0,0 +1,34 @@
+package querier
+
+import (
+	"jcosta/ephemeral-prom/compression"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadLocalFiles(t *testing.T) {
+	data := []byte("# EPH-SCRAPE 1000 host:80\nup 1\nfoo 2\n# EPH-SCRAPE 2000 host:80\nup 1\nfoo 3\n")
+	for _, codec := range []compression.Codec{compression.None, compression.Gzip, compression.Zstd} {
+		t.Run(string(codec), func(t *testing.T) {
+			compressed, err := codec.Compress(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			name := filepath.Join(t.TempDir(), "job.txt"+codec.Ext())
+			if err := os.WriteFile(name, compressed, 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			file, err := LocalFile(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ts := openTestStorage(t, 0)
+			report, _ := LoadFiles(ts, []*FileItem{file}, ViewOptions{}, nil)
+			if report.Appended != 4 || report.Scrapes != 2 || report.ParseErrors != 0 {
+				t.Errorf("report = %s, want 4 samples from 2 scrapes", report.Summary(5))
+			}
+		})
+	}
+}
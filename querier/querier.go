@@ -4,35 +4,47 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"jcosta/ephemeral-prom/bucket"
 	"log"
 	"time"
-
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/credentials"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
 )
 
-// go run . querier --src ./out.txt --query go_gc_gogc_percent --time 1754335979103
+// go run . querier --src ./out.txt --query go_gc_gogc_percent
 // Run executes the querier logic
 func Run(args []string) {
 	fs := flag.NewFlagSet("querier", flag.ExitOnError)
 
 	dataFile := fs.String("src", "", "Location of metrics file")
-	keyId := fs.String("keyId", "", "Access key id")
-	secretKey := fs.String("secretKey", "", "Secret access key")
-	bucket := fs.String("bucket", "", "S3 bucket name")
+	var bucketCfg bucket.Config
+	bucketCfg.RegisterFlags(fs)
 
 	//fileFormat := fs.String("format", "sequence", "Metrics file format.")
 	queryType := fs.String("type", "instant", "Query type: instant or range")
 	queryStr := fs.String("query", "", "PromQL query string")
-	startTs := fs.Int64("start", 0, "Start time (UNIX ms) - required for range")
-	endTs := fs.Int64("end", 0, "End time (UNIX ms) - required for range")
-	instantTs := fs.Int64("time", 0, "Instant query time (UNIX ms) - required for instant")
-	step := fs.Int64("step", 0, "Step interval for range queries (in seconds)")
-	endpoint := fs.String("endpoint", "", "R2 endpoint")
-
-	client := &s3.Client{}
+	startTs := fs.String("start", "", "Range start (RFC3339, UNIX ms, now-1h, end-30m, jobstart...), default the first sample loaded")
+	endTs := fs.String("end", "", "Range end (RFC3339, UNIX ms, now, jobend...), default the last sample loaded")
+	instantTs := fs.String("time", "", "Instant query time (RFC3339, UNIX ms, now-5m, jobend...), default the last sample loaded")
+	var step DurationFlag
+	fs.Var(&step, "step", "Step interval for range queries (30s, 5m or seconds), default fit to the range")
+	folders := fs.Bool("folders", false, "Browse bucket prefixes as folders")
+	alignMetric := fs.String("align-metric", "", "In comparison mode, align jobs on the first sample of this metric instead of their start")
+	lookback := DurationFlag(DefaultQueryLimits.LookbackDelta)
+	fs.Var(&lookback, "lookback", "Query lookback delta (5m, 30s or seconds)")
+	maxSamples := fs.Int("max-samples", DefaultQueryLimits.MaxSamples, "Maximum samples a query may load")
+	timeout := fs.Duration("timeout", DefaultQueryLimits.Timeout, "Query timeout")
+	concurrency := fs.Int("concurrency", DefaultQueryLimits.Concurrency, "Queries executed at once, the rest wait")
+	storageDir := fs.String("storage-dir", "", "Directory for the temporary query storage (default: system temp dir)")
+	oooWindow := fs.Duration("ooo-window", 0, "Accept out-of-order samples up to this far behind the newest sample loaded")
+	samplesPerChunk := fs.Int("samples-per-chunk", DefaultStorageOptions.SamplesPerChunk, "Target samples per storage chunk")
+	sortSamples := fs.Bool("sort", false, "Sort samples by series and time before loading them")
+	cacheDir := fs.String("cache-dir", DefaultCacheDir(), "Directory of the download cache")
+	cacheSize := fs.Int64("cache-size", DefaultCacheSize>>20, "Download cache cap in MiB, 0 disables the cache")
+	historyFile := fs.String("history", DefaultHistoryPath(), "Query history file, empty keeps history for the session only")
+	match := fs.String("match", "", "Only list jobs whose metadata matches, e.g. job_name=loadtest,format_version=2")
+	statsMode := fs.Bool("stats", false, "Print the cardinality and size report of --src, or of the jobs matching --match, instead of opening the UI")
+	statsTop := fs.Int("stats-top", DefaultStatsTop, "Rows per section of the stats report")
+
+	var src bucket.Bucket
 
 	// Parse arguments for this subcommand
 	if err := fs.Parse(args); err != nil {
@@ -40,68 +52,55 @@ func Run(args []string) {
 	}
 
 	// Validate
-	if *queryStr == "" {
+	if *queryStr == "" && !*statsMode {
 		log.Fatal("Error: --query is required")
 	}
 
 	//mode := ""
 
 	if *dataFile == "" {
-		fmt.Println("Reading from R2...")
-		if *keyId == "" {
-			log.Fatal("Error: --keyId is required")
-		}
-		if *endpoint == "" {
-			log.Fatal("Error: --endpoint is required")
-		}
-		if *secretKey == "" {
-			log.Fatal("Error: --secretKey is required")
-		}
-
-		if *bucket == "" {
+		fmt.Println("Reading from bucket...")
+		if bucketCfg.URL == "" {
 			log.Fatal("Error: --bucket is required")
 		}
 
-		// Create static credentials provider
-		creds := credentials.NewStaticCredentialsProvider(*keyId, *secretKey, "")
-
-		// Load AWS config without worrying about the global resolver
-		cfg, err := config.LoadDefaultConfig(
-			context.Background(),
-			config.WithCredentialsProvider(creds),
-			config.WithRegion("auto"), // "auto" works for R2
-		)
+		var err error
+		src, err = bucket.Open(context.Background(), bucketCfg)
 		if err != nil {
-			log.Fatalf("failed to load AWS config: %v", err)
+			log.Fatalf("failed to open bucket: %v", err)
 		}
 
-		client = s3.NewFromConfig(cfg, func(o *s3.Options) {
-			o.BaseEndpoint = aws.String(*endpoint)
-		})
-
 		//mode = "r2"
 
 	} else {
-		fmt.Printf("Reading metrics from file %s", *dataFile)
+		fmt.Printf("Reading metrics from file %s\n", *dataFile)
 		//mode = "file"
 	}
 
-	switch *queryType {
-	case "instant":
-		if *instantTs == 0 {
-			log.Fatal("Error: --time (UNIX ms) is required for instant queries")
+	// Times may refer to the jobs, which aren't loaded yet: only check them
+	// here, the session resolves them. Those not given default to the range
+	// of the loaded samples.
+	checkTime := func(name, expr string) string {
+		if expr == "" {
+			return "data range"
 		}
-		t := time.UnixMilli(*instantTs)
-		fmt.Printf("Instant query:\nQuery: %s\nTime: %s\n", *queryStr, t)
-
-	case "range":
-		if *startTs == 0 || *endTs == 0 || *step == 0 {
-			log.Fatal("Error: --start, --end (UNIX ms) and --step (seconds) are required for range queries")
+		if _, err := ParseTime(expr, TimeAnchors{}); err != nil {
+			log.Fatalf("Error: --%s: %v", name, err)
 		}
-		start := time.UnixMilli(*startTs)
-		end := time.UnixMilli(*endTs)
-		fmt.Printf("Range query:\nQuery: %s\nStart: %s\nEnd: %s\nStep: %ds\n",
-			*queryStr, start, end, *step)
+		return expr
+	}
+	switch {
+	case *statsMode:
+	case *queryType == "instant":
+		fmt.Printf("Instant query:\nQuery: %s\nTime: %s\n", *queryStr, checkTime("time", *instantTs))
+
+	case *queryType == "range":
+		stepText := "fit to the range"
+		if step > 0 {
+			stepText = time.Duration(step).String()
+		}
+		fmt.Printf("Range query:\nQuery: %s\nStart: %s\nEnd: %s\nStep: %s\n",
+			*queryStr, checkTime("start", *startTs), checkTime("end", *endTs), stepText)
 
 	default:
 		log.Fatal("Error: --type must be either 'instant' or 'range'")
@@ -110,8 +109,97 @@ func Run(args []string) {
 	tstart := time.Now()
 	// Create ephemeral in-memory storage
 
-	files := GetFiles(*bucket, *client)
-	OpenUI(*bucket, files, *client)
+	cache, err := OpenCache(*cacheDir, *cacheSize<<20)
+	if err != nil {
+		log.Fatalf("failed to open download cache: %v", err)
+	}
+
+	history, err := LoadHistory(*historyFile)
+	if err != nil {
+		log.Printf("failed to load history, keeping it for this session only: %v", err)
+		history, _ = LoadHistory("")
+	}
+
+	storageOpts := StorageOptions{
+		Dir:              *storageDir,
+		OutOfOrderWindow: *oooWindow,
+		SamplesPerChunk:  *samplesPerChunk,
+	}
+	if *statsMode {
+		printStats(src, bucketCfg.Prefix, *dataFile, *match, cache, ViewOptions{Storage: storageOpts, Sort: *sortSamples}, *statsTop)
+		return
+	}
+
+	uiOpts := UIOptions{
+		Folders:     *folders,
+		AlignMetric: *alignMetric,
+		Limits: QueryLimits{
+			LookbackDelta: time.Duration(lookback),
+			MaxSamples:    *maxSamples,
+			Timeout:       *timeout,
+			Concurrency:   *concurrency,
+		},
+		Sort:    *sortSamples,
+		Cache:   cache,
+		History: history,
+		Initial: InitialQuery{
+			Mode:  *queryType,
+			Time:  *instantTs,
+			Start: *startTs,
+			End:   *endTs,
+			Step:  time.Duration(step),
+		},
+		Storage: storageOpts,
+	}
+	if *dataFile != "" {
+		file, err := LocalFile(*dataFile)
+		if err != nil {
+			log.Fatalf("failed to read %s: %v", *dataFile, err)
+		}
+		OpenFileUI([]*FileItem{file}, uiOpts)
+	} else {
+		files := FilterFiles(GetFiles(src, bucketCfg.Prefix), *match)
+		OpenUI(src, bucketCfg.Prefix, files, uiOpts)
+	}
 
 	fmt.Printf("\nProgram execution time: %v\n", time.Since(tstart))
 }
+
+// printStats prints the stats report of the local file dataFile, or of the
+// bucket jobs matching match, downloaded through cache.
+func printStats(b bucket.Bucket, prefix, dataFile, match string, cache *Cache, opts ViewOptions, top int) {
+	var files []*FileItem
+	if dataFile != "" {
+		file, err := LocalFile(dataFile)
+		if err != nil {
+			log.Fatalf("failed to read %s: %v", dataFile, err)
+		}
+		files = append(files, file)
+	} else {
+		items := FilterFiles(GetFiles(b, prefix), match)
+		for i := range items {
+			file := &items[i]
+			if !cache.Load(b.Name(), file) {
+				fmt.Printf("Downloading %s (%d bytes)\n", file.Name, file.Size)
+				if err := DownloadFile(context.Background(), b, file, nil); err != nil {
+					log.Fatalf("failed to download %s: %v", file.Name, err)
+				}
+				if err := cache.Store(b.Name(), file); err != nil {
+					log.Printf("failed to cache %s: %v", file.Name, err)
+				}
+			}
+			files = append(files, file)
+		}
+	}
+	if len(files) == 0 {
+		log.Fatal("Error: no jobs to analyze")
+	}
+
+	stats, load, err := JobStats(files, opts, top)
+	if err != nil {
+		log.Fatalf("failed to build stats: %v", err)
+	}
+	fmt.Println(load.Summary(top))
+	fmt.Println()
+	fmt.Print(stats.Format(top))
+}
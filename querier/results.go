@@ -0,0 +1,218 @@
+package querier
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/rivo/tview"
+)
+
+// ResultTable browses instant query results, one row per sample and one
+// column per label name plus the value. s sorts by the selected column
+// (again to reverse), / filters rows and Enter copies the row's selector to
+// the input line.
+type ResultTable struct {
+	*tview.Flex
+	table  *tview.Table
+	filter *tview.InputField
+
+	vector     promql.Vector
+	rows       promql.Vector // vector filtered and sorted
+	labelNames []string
+	sortCol    int // index into columns, the value column is last
+	sortDesc   bool
+
+	focus  func(p tview.Primitive)
+	onCopy func(selector string)
+}
+
+// NewResultTable returns an empty result table. focus moves the focus, it is
+// how / reaches the filter field. onCopy receives the selector of the row
+// Enter was pressed on.
+func NewResultTable(focus func(p tview.Primitive), onCopy func(selector string)) *ResultTable {
+	r := &ResultTable{
+		Flex:     tview.NewFlex().SetDirection(tview.FlexRow),
+		table:    tview.NewTable(),
+		filter:   tview.NewInputField(),
+		sortDesc: true,
+		focus:    focus,
+		onCopy:   onCopy,
+	}
+	r.SetBorder(true).SetTitle(" results ")
+
+	r.table.
+		SetSelectable(true, true).
+		SetFixed(1, 0)
+	r.table.SetSelectedFunc(func(row, column int) {
+		if row == 0 {
+			r.sortBy(column)
+			return
+		}
+		if row <= len(r.rows) {
+			if selector := Selector(r.rows[row-1].Metric); selector != "" {
+				r.onCopy(selector)
+			}
+		}
+	})
+	r.table.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch event.Rune() {
+		case 's':
+			_, column := r.table.GetSelection()
+			r.sortBy(column)
+			return nil
+		case '/':
+			r.focus(r.filter)
+			return nil
+		}
+		return event
+	})
+
+	r.filter.
+		SetLabel("/").
+		SetPlaceholder("label=value, label!=value or text").
+		SetFieldWidth(0).
+		SetChangedFunc(func(string) { r.render() }).
+		SetDoneFunc(func(tcell.Key) { r.focus(r.table) })
+
+	r.AddItem(r.filter, 1, 0, false).
+		AddItem(r.table, 0, 1, true)
+	return r
+}
+
+// SetVector replaces the rows with v, keeping the filter and sorting by value.
+func (r *ResultTable) SetVector(v promql.Vector) {
+	r.vector = v
+	names := map[string]struct{}{}
+	for _, s := range v {
+		s.Metric.Range(func(l labels.Label) { names[l.Name] = struct{}{} })
+	}
+	r.labelNames = slices.SortedFunc(maps.Keys(names), func(a, b string) int {
+		// __name__ first, as in a selector
+		if (a == labels.MetricName) != (b == labels.MetricName) {
+			if a == labels.MetricName {
+				return -1
+			}
+			return 1
+		}
+		return strings.Compare(a, b)
+	})
+	r.sortCol = len(r.labelNames)
+	r.sortDesc = true
+	r.render()
+	r.table.Select(1, r.sortCol).ScrollToBeginning()
+}
+
+// Len returns the number of samples shown.
+func (r *ResultTable) Len() int {
+	return len(r.vector)
+}
+
+func (r *ResultTable) sortBy(column int) {
+	if column == r.sortCol {
+		r.sortDesc = !r.sortDesc
+	} else {
+		r.sortCol = column
+		// Values read best largest first, labels alphabetically
+		r.sortDesc = column == len(r.labelNames)
+	}
+	r.render()
+}
+
+func (r *ResultTable) render() {
+	r.rows = r.rows[:0]
+	for _, s := range r.vector {
+		if MatchSample(s.Metric, r.filter.GetText()) {
+			r.rows = append(r.rows, s)
+		}
+	}
+	slices.SortStableFunc(r.rows, func(a, b promql.Sample) int {
+		var c int
+		if r.sortCol >= len(r.labelNames) {
+			c = cmp.Compare(a.F, b.F)
+		} else {
+			name := r.labelNames[r.sortCol]
+			c = strings.Compare(a.Metric.Get(name), b.Metric.Get(name))
+		}
+		if r.sortDesc {
+			c = -c
+		}
+		return c
+	})
+
+	r.table.Clear()
+	headers := append(slices.Clone(r.labelNames), "value")
+	for i, h := range headers {
+		if i == r.sortCol {
+			if r.sortDesc {
+				h += " ▼"
+			} else {
+				h += " ▲"
+			}
+		}
+		r.table.SetCell(0, i, tview.NewTableCell(h).
+			SetTextColor(tcell.ColorYellow).
+			SetAttributes(tcell.AttrBold).
+			SetExpansion(1))
+	}
+	for row, s := range r.rows {
+		for i, name := range r.labelNames {
+			r.table.SetCell(row+1, i, tview.NewTableCell(tview.Escape(s.Metric.Get(name))).SetExpansion(1))
+		}
+		value := strconv.FormatFloat(s.F, 'g', -1, 64)
+		if s.H != nil {
+			value = s.H.String()
+		}
+		r.table.SetCell(row+1, len(r.labelNames), tview.NewTableCell(value).
+			SetTextColor(tcell.ColorGreen).
+			SetAlign(tview.AlignRight).
+			SetExpansion(1))
+	}
+	r.SetTitle(fmt.Sprintf(" results [blue](%d/%d)[-] ", len(r.rows), len(r.vector)))
+}
+
+// MatchSample reports whether lset matches every space separated term of
+// filter: label=value, label!=value, or text found in the series.
+func MatchSample(lset labels.Labels, filter string) bool {
+	for _, term := range strings.Fields(filter) {
+		if name, value, ok := strings.Cut(term, "!="); ok {
+			if lset.Get(name) == value {
+				return false
+			}
+			continue
+		}
+		if name, value, ok := strings.Cut(term, "="); ok {
+			if lset.Get(name) != value {
+				return false
+			}
+			continue
+		}
+		if !strings.Contains(lset.String(), term) {
+			return false
+		}
+	}
+	return true
+}
+
+// Selector returns the PromQL selector matching exactly lset, e.g.
+// up{job="node"}, the bare metric name when it has no other label, and ""
+// when lset is empty, as the result of sum(x) is.
+func Selector(lset labels.Labels) string {
+	var matchers []string
+	lset.Range(func(l labels.Label) {
+		if l.Name != labels.MetricName {
+			matchers = append(matchers, l.Name+"="+strconv.Quote(l.Value))
+		}
+	})
+	name := lset.Get(labels.MetricName)
+	if len(matchers) == 0 {
+		return name
+	}
+	return name + "{" + strings.Join(matchers, ", ") + "}"
+}
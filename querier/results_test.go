@@ -0,0 +1,33 @@
+package querier
+
+import (
+	"testing"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+func TestSelector(t *testing.T) {
+	tests := []struct {
+		lset labels.Labels
+		want string
+	}{
+		{labels.FromStrings("__name__", "up", "job", "node"), `up{job="node"}`},
+		{labels.FromStrings("__name__", "up"), "up"},
+		{labels.FromStrings("job", "node", "mode", "idle"), `{job="node", mode="idle"}`},
+		{labels.FromStrings("__name__", "up", "path", `a"b\c`), `up{path="a\"b\\c"}`},
+		{labels.EmptyLabels(), ""},
+	}
+	for _, tt := range tests {
+		got := Selector(tt.lset)
+		if got != tt.want {
+			t.Errorf("Selector(%s) = %s, want %s", tt.lset, got, tt.want)
+		}
+		if got == "" {
+			continue
+		}
+		if _, err := parser.ParseExpr(got); err != nil {
+			t.Errorf("Selector(%s) = %s, which doesn't parse: %v", tt.lset, got, err)
+		}
+	}
+}
@@ -1,140 +1,262 @@
 package querier
 
 import (
+	"bufio"
 	"bytes"
 	"fmt"
+	"io"
+	"jcosta/ephemeral-prom/manifest"
 	"log"
-	"os"
+	"runtime"
+	"time"
 
-	io_prometheus_client "github.com/prometheus/client_model/go"
-	"github.com/prometheus/common/expfmt"
 	"github.com/prometheus/prometheus/model/labels"
-	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/model/textparse"
+	"github.com/prometheus/prometheus/tsdb"
 )
 
-func ParseSequenceFile(app storage.Appender, dataFile string) {
-	f, err := os.Open(dataFile)
-	if err != nil {
-		log.Fatalf("Error opening metrics file: %v", err)
-	}
-	defer f.Close()
+// LoadOptions changes how samples are appended to the storage.
+type LoadOptions struct {
+	// JobLabel, if set, is added to every series as eph_job.
+	JobLabel string
+	// TimeOffset (ms) is subtracted from every sample timestamp.
+	TimeOffset int64
+	// OutOfOrderWindow must match the storage's, samples further behind the
+	// newest sample loaded are counted as rejected.
+	OutOfOrderWindow time.Duration
+	// Sort orders samples by series and time before appending them.
+	Sort bool
+	// Progress, if set, is called with the number of bytes read so far
+	// every progressInterval bytes and once at the end.
+	Progress func(read int64)
+}
 
-	cleaned, err := CleanupScrapeFile(f)
-	if err != nil {
-		panic(err)
-	}
+const progressInterval = 1 << 20
 
-	// Parse metrics file
-	var parser expfmt.TextParser
-	metricFamilies, err := parser.TextToMetricFamilies(bytes.NewReader(cleaned))
+// maxReportedParseErrors bounds the parse errors kept in a LoadReport.
+const maxReportedParseErrors = 5
 
-	if err != nil {
-		log.Fatalf("Error parsing metrics: %v", err)
+// ParseSequenceString appends the samples in data to db and reports the
+// samples that were out of order, duplicated or rejected. Data with scrape
+// record headers is split into chunks on scrape boundaries that are parsed
+// concurrently, samples are still appended in file order.
+func ParseSequenceString(db *tsdb.DB, data []byte, opts LoadOptions) LoadReport {
+	chunks := SplitScrapes(data, parseChunkSize)
+	if len(chunks) <= 1 {
+		return ParseSequence(db, bytes.NewReader(data), opts)
 	}
 
-	for name, mf := range metricFamilies {
-		for _, m := range mf.Metric {
-			var tsMillis int64
-			if m.TimestampMs != nil {
-				tsMillis = *m.TimestampMs
-			} else {
-				// If no explicit timestamp, continue
-				fmt.Println("Metric without timestamp")
-				continue
-			}
-
-			// Convert labels to Prometheus internal type
-			lbls := labels.NewBuilder(labels.EmptyLabels()).
-				Set("__name__", name)
+	type parsedChunk struct {
+		samples []sample
+		report  LoadReport
+	}
+	results := make([]chan parsedChunk, len(chunks))
+	for i := range results {
+		results[i] = make(chan parsedChunk, 1)
+	}
 
-			for _, lp := range m.Label {
-				lbls.Set(lp.GetName(), lp.GetValue())
-			}
+	// At most GOMAXPROCS chunks are parsed or waiting to be appended at
+	// once, which bounds the samples held in memory.
+	slots := make(chan struct{}, runtime.GOMAXPROCS(0))
+	go func() {
+		for i, chunk := range chunks {
+			slots <- struct{}{}
+			go func() {
+				var parsed parsedChunk
+				p := newChunkParser(opts, &parsed.report, func(lset labels.Labels, t int64, v float64) {
+					parsed.samples = append(parsed.samples, sample{lset: lset, t: t, v: v})
+				})
+				p.lineNo = chunk.FirstLine - 1
+				p.parse(bytes.NewReader(chunk.Data), nil)
+				results[i] <- parsed
+			}()
+		}
+	}()
 
-			lset := lbls.Labels()
-
-			// Handle metric types
-			switch mf.GetType() {
-			case io_prometheus_client.MetricType_COUNTER:
-				_, err = app.Append(0, lset, tsMillis, m.GetCounter().GetValue())
-			case io_prometheus_client.MetricType_GAUGE:
-				_, err = app.Append(0, lset, tsMillis, m.GetGauge().GetValue())
-			case io_prometheus_client.MetricType_UNTYPED:
-				_, err = app.Append(0, lset, tsMillis, m.GetUntyped().GetValue())
-			case io_prometheus_client.MetricType_SUMMARY:
-				_, err = app.Append(0, lset, tsMillis, m.GetSummary().GetSampleSum())
-			case io_prometheus_client.MetricType_HISTOGRAM:
-				_, err = app.Append(0, lset, tsMillis, m.GetHistogram().GetSampleSum())
-			}
+	l := newLoader(db, opts)
+	var read int64
+	for i, chunk := range chunks {
+		parsed := <-results[i]
+		for _, s := range parsed.samples {
+			l.Append(s.lset, s.t, s.v)
+		}
+		l.report.Merge(parsed.report)
+		<-slots
 
-			if err != nil {
-				log.Printf("Append error for %s: %v", name, err)
-			}
+		read += int64(len(chunk.Data))
+		if opts.Progress != nil {
+			opts.Progress(read)
 		}
 	}
 
-	if err := app.Commit(); err != nil {
+	report, err := l.Commit()
+	if err != nil {
 		log.Fatal(err)
 	}
+	return report
 }
 
-func ParseSequenceString(app storage.Appender, data []byte) {
+// parseChunkSize is the target size of the chunks parsed concurrently.
+const parseChunkSize = 4 << 20
 
-	cleaned, err := CleanupScrapeBytes(data)
-	if err != nil {
-		panic(err)
+// Chunk is a run of whole scrape records of a job file.
+type Chunk struct {
+	Data []byte
+	// FirstLine is the line number of the chunk's first line in the file.
+	FirstLine int
+}
+
+// SplitScrapes cuts data into chunks of at least size bytes, each ending
+// right before a scrape record header. Data without headers is a single
+// chunk.
+func SplitScrapes(data []byte, size int) []Chunk {
+	var chunks []Chunk
+	line := 1
+	header := []byte("\n" + manifest.ScrapePrefix)
+	for len(data) > size {
+		i := bytes.Index(data[size:], header)
+		if i < 0 {
+			break
+		}
+		end := size + i + 1
+		chunks = append(chunks, Chunk{Data: data[:end], FirstLine: line})
+		line += bytes.Count(data[:end], []byte("\n"))
+		data = data[end:]
 	}
+	return append(chunks, Chunk{Data: data, FirstLine: line})
+}
 
-	// Parse metrics file
-	var parser expfmt.TextParser
-	metricFamilies, err := parser.TextToMetricFamilies(bytes.NewReader(cleaned))
+// ParseSequence reads Prometheus text exposition lines from r and appends
+// every sample as soon as its line is read. Lines are parsed independently,
+// so the HELP/TYPE comments repeated by appended scrapes don't matter and a
+// malformed line only loses itself.
+//
+// A manifest.ScrapeHeader line starts a new scrape record, its timestamp is
+// used for the samples of the record that have none. Samples repeating a
+// series and timestamp, within a scrape or across scrapes, are reported as
+// duplicate or conflicting rather than overwritten.
+func ParseSequence(db *tsdb.DB, r io.Reader, opts LoadOptions) LoadReport {
+	l := newLoader(db, opts)
+	newChunkParser(opts, &l.report, l.Append).parse(r, opts.Progress)
 
+	report, err := l.Commit()
 	if err != nil {
-		log.Fatalf("Error parsing metrics: %v", err)
+		log.Fatal(err)
 	}
+	return report
+}
 
-	for name, mf := range metricFamilies {
-		for _, m := range mf.Metric {
-			var tsMillis int64
-			if m.TimestampMs != nil {
-				tsMillis = *m.TimestampMs
-			} else {
-				// If no explicit timestamp, continue
-				fmt.Println("Metric without timestamp")
-				continue
-			}
+// chunkParser parses job file lines, counting scrapes and malformed lines in
+// report and passing every sample to emit.
+type chunkParser struct {
+	opts     LoadOptions
+	report   *LoadReport
+	emit     func(lset labels.Labels, t int64, v float64)
+	symbols  *labels.SymbolTable
+	builder  *labels.Builder
+	lset     labels.Labels
+	lineNo   int
+	scrapeTs *int64 // timestamp of the current scrape record, if any
+}
 
-			// Convert labels to Prometheus internal type
-			lbls := labels.NewBuilder(labels.EmptyLabels()).
-				Set("__name__", name)
+func newChunkParser(opts LoadOptions, report *LoadReport, emit func(labels.Labels, int64, float64)) *chunkParser {
+	return &chunkParser{
+		opts:    opts,
+		report:  report,
+		emit:    emit,
+		symbols: labels.NewSymbolTable(),
+		builder: labels.NewBuilder(labels.EmptyLabels()),
+	}
+}
 
-			for _, lp := range m.Label {
-				lbls.Set(lp.GetName(), lp.GetValue())
-			}
+// parse reads r to the end, calling progress with the bytes read so far
+// every progressInterval bytes and once at the end.
+func (p *chunkParser) parse(r io.Reader, progress func(read int64)) {
+	reader := bufio.NewReaderSize(r, 64*1024)
 
-			lset := lbls.Labels()
-
-			// Handle metric types
-			switch mf.GetType() {
-			case io_prometheus_client.MetricType_COUNTER:
-				_, err = app.Append(0, lset, tsMillis, m.GetCounter().GetValue())
-			case io_prometheus_client.MetricType_GAUGE:
-				_, err = app.Append(0, lset, tsMillis, m.GetGauge().GetValue())
-			case io_prometheus_client.MetricType_UNTYPED:
-				_, err = app.Append(0, lset, tsMillis, m.GetUntyped().GetValue())
-			case io_prometheus_client.MetricType_SUMMARY:
-				_, err = app.Append(0, lset, tsMillis, m.GetSummary().GetSampleSum())
-			case io_prometheus_client.MetricType_HISTOGRAM:
-				_, err = app.Append(0, lset, tsMillis, m.GetHistogram().GetSampleSum())
+	var read, lastProgress int64
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			p.lineNo++
+			read += int64(len(line))
+			if progress != nil && read-lastProgress >= progressInterval {
+				progress(read)
+				lastProgress = read
 			}
 
-			if err != nil {
-				log.Printf("Append error for %s: %v", name, err)
+			// Normalize Windows CRLF → LF
+			line = bytes.TrimRight(line, "\r\n")
+			if ts, _, ok := manifest.ParseScrapeHeader(line); ok {
+				p.report.Scrapes++
+				p.scrapeTs = &ts
+			} else if len(line) > 0 && line[0] != '#' {
+				p.parseLine(append(line, '\n'))
 			}
 		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			p.report.addParseError(fmt.Errorf("read: %w", err))
+			break
+		}
+	}
+	if progress != nil {
+		progress(read)
 	}
+}
 
-	if err := app.Commit(); err != nil {
-		log.Fatal(err)
+func (p *chunkParser) parseLine(line []byte) {
+	parser := textparse.NewPromParser(line, p.symbols, false)
+	for {
+		entry, err := parser.Next()
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			p.report.addParseError(fmt.Errorf("line %d: %w", p.lineNo, err))
+			return
+		}
+		if entry != textparse.EntrySeries {
+			continue
+		}
+
+		_, ts, v := parser.Series()
+		if ts == nil {
+			ts = p.scrapeTs
+		}
+		if ts == nil {
+			p.report.NoTimestamp++
+			continue
+		}
+
+		parser.Labels(&p.lset)
+		if p.opts.JobLabel != "" {
+			p.builder.Reset(p.lset)
+			p.builder.Set(EphJobLabel, p.opts.JobLabel)
+			p.lset = p.builder.Labels()
+		}
+		p.emit(p.lset.Copy(), *ts-p.opts.TimeOffset, v)
 	}
 }
+
+// JobAnchor returns the timestamp a job is aligned on in comparison mode: its
+// first sample, or the first sample of marker when set. Samples without a
+// timestamp take their scrape header's, as when loading.
+func JobAnchor(data []byte, marker string) (int64, bool) {
+	var anchor int64
+	found := false
+	var report LoadReport
+	p := newChunkParser(LoadOptions{}, &report, func(lset labels.Labels, t int64, _ float64) {
+		if marker != "" && lset.Get(labels.MetricName) != marker {
+			return
+		}
+		if !found || t < anchor {
+			anchor = t
+			found = true
+		}
+	})
+	p.parse(bytes.NewReader(data), nil)
+	return anchor, found
+}
@@ -0,0 +1,274 @@
+package querier
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/model/labels"
+)
+
+func TestSplitScrapes(t *testing.T) {
+	data := "# EPH-SCRAPE 1000 a\nup 1\n# EPH-SCRAPE 2000 a\nup 1\nfoo 2\n# EPH-SCRAPE 3000 a\nup 0\n"
+	tests := []struct {
+		name  string
+		data  string
+		size  int
+		want  []string
+		lines []int
+	}{
+		{
+			name:  "no headers",
+			data:  "up 1 1000\nup 1 2000\n",
+			size:  5,
+			want:  []string{"up 1 1000\nup 1 2000\n"},
+			lines: []int{1},
+		},
+		{
+			name:  "larger than data",
+			data:  data,
+			size:  len(data),
+			want:  []string{data},
+			lines: []int{1},
+		},
+		{
+			name: "one scrape per chunk",
+			data: data,
+			size: 1,
+			want: []string{
+				"# EPH-SCRAPE 1000 a\nup 1\n",
+				"# EPH-SCRAPE 2000 a\nup 1\nfoo 2\n",
+				"# EPH-SCRAPE 3000 a\nup 0\n",
+			},
+			lines: []int{1, 3, 6},
+		},
+		{
+			name: "chunks of at least size",
+			data: data,
+			size: 30,
+			want: []string{
+				"# EPH-SCRAPE 1000 a\nup 1\n# EPH-SCRAPE 2000 a\nup 1\nfoo 2\n",
+				"# EPH-SCRAPE 3000 a\nup 0\n",
+			},
+			lines: []int{1, 6},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunks := SplitScrapes([]byte(tt.data), tt.size)
+			var got []string
+			var lines []int
+			for _, c := range chunks {
+				got = append(got, string(c.Data))
+				lines = append(lines, c.FirstLine)
+			}
+			if !reflect.DeepEqual(got, tt.want) || !reflect.DeepEqual(lines, tt.lines) {
+				t.Errorf("SplitScrapes() = %q at lines %v, want %q at lines %v", got, lines, tt.want, tt.lines)
+			}
+		})
+	}
+}
+
+func TestParseSequenceCounts(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   string
+		window time.Duration
+		want   LoadReport
+		series map[string]SeriesReport
+	}{
+		{
+			name: "header timestamps",
+			data: "# EPH-SCRAPE 1000 a\nup 1\nfoo 2 500\n# EPH-SCRAPE 2000 a\nup 1\n",
+			want: LoadReport{Appended: 3, Scrapes: 2},
+		},
+		{
+			name: "no timestamp without header",
+			data: "up 1\nup 1 1000\n",
+			want: LoadReport{Appended: 1, NoTimestamp: 1},
+		},
+		{
+			name: "duplicate across scrapes",
+			data: "# EPH-SCRAPE 1000 a\nup 1\n# EPH-SCRAPE 1000 a\nup 1\n",
+			want: LoadReport{Appended: 1, Scrapes: 2},
+			series: map[string]SeriesReport{
+				`{__name__="up"}`: {Duplicate: 1},
+			},
+		},
+		{
+			name: "conflicting keeps the first value",
+			data: "up 1 1000\nup 0 1000\nup 1 1000\n",
+			want: LoadReport{Appended: 1},
+			series: map[string]SeriesReport{
+				`{__name__="up"}`: {Conflicting: 1, Duplicate: 1},
+			},
+		},
+		{
+			name: "out of order without window",
+			data: "up 1 2000\nup 1 1000\n",
+			want: LoadReport{Appended: 1},
+			series: map[string]SeriesReport{
+				`{__name__="up"}`: {Rejected: 1},
+			},
+		},
+		{
+			name:   "out of order within window",
+			data:   "up 1 2000\nup 1 1000\n",
+			window: 5 * time.Second,
+			want:   LoadReport{Appended: 2},
+			series: map[string]SeriesReport{
+				`{__name__="up"}`: {OutOfOrder: 1},
+			},
+		},
+		{
+			name:   "window measured from the newest sample of any series",
+			data:   "a 1 100000\nb 1 10000\nb 2 9000\n",
+			window: 5 * time.Second,
+			want:   LoadReport{Appended: 2},
+			series: map[string]SeriesReport{
+				`{__name__="b"}`: {Rejected: 1},
+			},
+		},
+		{
+			name: "malformed line",
+			data: "up 1 1000\nup{ 1 2000\nup 1 3000\n",
+			want: LoadReport{Appended: 2, ParseErrors: 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := openTestStorage(t, tt.window)
+			got := ParseSequence(ts.DB, strings.NewReader(tt.data), LoadOptions{OutOfOrderWindow: tt.window})
+
+			if got.Appended != tt.want.Appended || got.Scrapes != tt.want.Scrapes ||
+				got.NoTimestamp != tt.want.NoTimestamp || got.ParseErrors != tt.want.ParseErrors {
+				t.Errorf("report = %+v, want %+v", got, tt.want)
+			}
+			series := map[string]SeriesReport{}
+			for k, s := range got.Series {
+				series[k] = *s
+			}
+			if len(series) == 0 && len(tt.series) == 0 {
+				series = tt.series
+			}
+			if !reflect.DeepEqual(series, tt.series) {
+				t.Errorf("series = %+v, want %+v", series, tt.series)
+			}
+			if n := headSamples(t, ts); n != got.Appended {
+				t.Errorf("storage holds %d samples, report says %d appended", n, got.Appended)
+			}
+		})
+	}
+}
+
+// TestParseSequenceChunked checks that concurrent chunk parsing loads and
+// reports the same as sequential parsing, including duplicates, conflicts
+// and out-of-order samples across chunk boundaries.
+func TestParseSequenceChunked(t *testing.T) {
+	var data bytes.Buffer
+	for scrape := 0; data.Len() < 3*parseChunkSize; scrape++ {
+		fmt.Fprintf(&data, "# EPH-SCRAPE %d target\n", 1000+scrape*1000)
+		for i := range 50 {
+			fmt.Fprintf(&data, "metric{i=\"%d\"} %d\n", i, scrape)
+		}
+		switch scrape % 1000 {
+		case 10:
+			// Conflicts with the sample above
+			fmt.Fprintf(&data, "metric{i=\"1\"} -1\n")
+		case 20:
+			// Duplicates the sample above, with the header's timestamp
+			fmt.Fprintf(&data, "metric{i=\"2\"} %d %d\n", scrape, 1000+scrape*1000)
+		case 30:
+			// Out of order, kept
+			fmt.Fprintf(&data, "metric{i=\"3\"} 0 %d\n", scrape*1000+500)
+		case 35:
+			// Out of order, rejected
+			fmt.Fprintf(&data, "metric{i=\"3\"} 0 %d\n", scrape*1000-500)
+		case 40:
+			data.WriteString("metric{i=\"4\" 1\n")
+		}
+	}
+	if n := len(SplitScrapes(data.Bytes(), parseChunkSize)); n < 2 {
+		t.Fatalf("test data is %d chunk, want several", n)
+	}
+
+	opts := LoadOptions{OutOfOrderWindow: time.Second}
+	sequential := openTestStorage(t, opts.OutOfOrderWindow)
+	want := ParseSequence(sequential.DB, bytes.NewReader(data.Bytes()), opts)
+	chunked := openTestStorage(t, opts.OutOfOrderWindow)
+	got := ParseSequenceString(chunked.DB, data.Bytes(), opts)
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("chunked report = %s\nsequential report = %s", got.Summary(5), want.Summary(5))
+	}
+	var counts SeriesReport
+	for _, s := range got.Series {
+		counts.OutOfOrder += s.OutOfOrder
+		counts.Duplicate += s.Duplicate
+		counts.Conflicting += s.Conflicting
+		counts.Rejected += s.Rejected
+	}
+	if counts.OutOfOrder == 0 || counts.Duplicate == 0 || counts.Conflicting == 0 || counts.Rejected == 0 || got.ParseErrors == 0 {
+		t.Errorf("report = %s, want every kind of sample counted", got.Summary(5))
+	}
+
+	matcher := labels.MustNewMatcher(labels.MatchRegexp, labels.MetricName, ".+")
+	wantSeries, err := ListSeries(sequential.DB, matcher)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gotSeries, err := ListSeries(chunked.DB, matcher)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(gotSeries, wantSeries) {
+		t.Errorf("chunked load holds %d series, sequential %d, or they differ", len(gotSeries), len(wantSeries))
+	}
+}
+
+func TestJobAnchor(t *testing.T) {
+	tests := []struct {
+		data   string
+		marker string
+		want   int64
+		ok     bool
+	}{
+		{"up 1 3000\nup 1 2000\n", "", 2000, true},
+		{"# EPH-SCRAPE 5000 x\nfoo 42\nbar 7", "", 5000, true},
+		{"# EPH-SCRAPE 5000 x\nfoo{a=\"x 1\"} 42 3000\nbar 7\n", "bar", 5000, true},
+		{"up 1 3000\n", "down", 0, false},
+		{"up 1\n", "", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := JobAnchor([]byte(tt.data), tt.marker)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("JobAnchor(%q, %q) = %d, %v, want %d, %v", tt.data, tt.marker, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func openTestStorage(t *testing.T, window time.Duration) *Storage {
+	t.Helper()
+	ts, err := OpenStorage(StorageOptions{Dir: t.TempDir(), OutOfOrderWindow: window})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ts.Close() })
+	return ts
+}
+
+func headSamples(t *testing.T, ts *Storage) int {
+	t.Helper()
+	series, err := ListSeries(ts.DB, labels.MustNewMatcher(labels.MatchRegexp, labels.MetricName, ".+"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for _, s := range series {
+		n += s.Samples
+	}
+	return n
+}
@@ -0,0 +1,91 @@
+package querier
+
+import (
+	"context"
+	"math"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+	"github.com/prometheus/prometheus/tsdb/index"
+)
+
+// SeriesInfo is a series with its sample count and time coverage.
+type SeriesInfo struct {
+	Labels           labels.Labels
+	Samples          int
+	MinTime, MaxTime int64 // ms
+}
+
+// ListSeries returns the series matching matchers. Sample counts come from
+// chunk headers, only the first and last chunks of a series are decoded for
+// its time range.
+func ListSeries(db *tsdb.DB, matchers ...*labels.Matcher) ([]SeriesInfo, error) {
+	q, err := db.ChunkQuerier(math.MinInt64, math.MaxInt64)
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+
+	var series []SeriesInfo
+	var it chunkenc.Iterator
+	set := q.Select(context.Background(), false, nil, matchers...)
+	for set.Next() {
+		s := set.At()
+		info := SeriesInfo{Labels: s.Labels(), MinTime: math.MaxInt64, MaxTime: math.MinInt64}
+		chunks := s.Iterator(nil)
+		var last chunkenc.Chunk
+		for chunks.Next() {
+			meta := chunks.At()
+			info.Samples += meta.Chunk.NumSamples()
+			if info.MinTime == math.MaxInt64 {
+				it = meta.Chunk.Iterator(it)
+				if it.Next() != chunkenc.ValNone {
+					info.MinTime = it.AtT()
+				}
+			}
+			last = meta.Chunk
+		}
+		if err := chunks.Err(); err != nil {
+			return nil, err
+		}
+		if last == nil {
+			continue
+		}
+		it = last.Iterator(it)
+		for it.Next() != chunkenc.ValNone {
+			info.MaxTime = it.AtT()
+		}
+		series = append(series, info)
+	}
+	return series, set.Err()
+}
+
+// MetricSeriesCounts returns the number of series of every metric name,
+// from the head index.
+func MetricSeriesCounts(db *tsdb.DB) (map[string]int, error) {
+	ctx := context.Background()
+	ir, err := db.Head().Index()
+	if err != nil {
+		return nil, err
+	}
+	defer ir.Close()
+
+	names, err := ir.SortedLabelValues(ctx, labels.MetricName, nil)
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int, len(names))
+	for _, name := range names {
+		p, err := ir.Postings(ctx, labels.MetricName, name)
+		if err != nil {
+			return nil, err
+		}
+		refs, err := index.ExpandPostings(p)
+		if err != nil {
+			return nil, err
+		}
+		counts[name] = len(refs)
+	}
+	return counts, nil
+}
@@ -0,0 +1,229 @@
+package querier
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"fmt"
+	"jcosta/ephemeral-prom/compression"
+	"slices"
+	"strings"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/textparse"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/prometheus/prometheus/tsdb/index"
+)
+
+// DefaultStatsTop is the number of rows of every stats section.
+const DefaultStatsTop = 20
+
+// NameStats is what a metric or label name contributes to the loaded jobs.
+type NameStats struct {
+	Name    string
+	Values  int // distinct values, for label names
+	Series  int
+	Samples int
+	// Bytes of the source lines of a metric (its HELP and TYPE included), or
+	// of the name="value" pairs of a label name, about as written.
+	Bytes int64
+}
+
+// StatsReport is a cardinality and size analysis of the loaded jobs, in the
+// spirit of the Prometheus TSDB status page. Metrics and Labels are sorted
+// by source bytes, largest first.
+type StatsReport struct {
+	Series   int
+	Samples  int
+	Bytes    int64 // of the decompressed sources
+	Overhead int64 // bytes of scrape headers and other comments
+	Metrics  []NameStats
+	Labels   []NameStats
+	// TopLabels are the label names with the most values and TopPairs the
+	// label pairs with the most series, from the head index.
+	TopLabels []index.Stat
+	TopPairs  []index.Stat
+}
+
+// BuildStats analyzes the series of db and the job files they were loaded
+// from. Sources may be compressed, labels added while loading (eph_job)
+// have no source bytes.
+func BuildStats(db *tsdb.DB, sources [][]byte, top int) (StatsReport, error) {
+	var r StatsReport
+	series, err := ListSeries(db, labels.MustNewMatcher(labels.MatchRegexp, labels.MetricName, ".+"))
+	if err != nil {
+		return r, err
+	}
+
+	metrics := map[string]*NameStats{}
+	labelNames := map[string]*NameStats{}
+	values := map[string]map[string]struct{}{}
+	get := func(m map[string]*NameStats, name string) *NameStats {
+		s, ok := m[name]
+		if !ok {
+			s = &NameStats{Name: name}
+			m[name] = s
+		}
+		return s
+	}
+	for _, s := range series {
+		r.Series++
+		r.Samples += s.Samples
+		m := get(metrics, s.Labels.Get(labels.MetricName))
+		m.Series++
+		m.Samples += s.Samples
+		s.Labels.Range(func(l labels.Label) {
+			if l.Name == labels.MetricName {
+				return
+			}
+			ls := get(labelNames, l.Name)
+			ls.Series++
+			ls.Samples += s.Samples
+			if values[l.Name] == nil {
+				values[l.Name] = map[string]struct{}{}
+			}
+			values[l.Name][l.Value] = struct{}{}
+		})
+	}
+
+	for _, data := range sources {
+		data, err := compression.Decompress(data)
+		if err != nil {
+			return r, err
+		}
+		r.Bytes += int64(len(data))
+		r.Overhead += sourceBytes(data, func(metric string, n int64) {
+			get(metrics, metric).Bytes += n
+		}, func(label string, n int64) {
+			get(labelNames, label).Bytes += n
+		})
+	}
+
+	bySize := func(a, b NameStats) int {
+		return cmp.Or(cmp.Compare(b.Bytes, a.Bytes), cmp.Compare(b.Series, a.Series), strings.Compare(a.Name, b.Name))
+	}
+	for _, m := range metrics {
+		r.Metrics = append(r.Metrics, *m)
+	}
+	slices.SortFunc(r.Metrics, bySize)
+	for name, l := range labelNames {
+		l.Values = len(values[name])
+		r.Labels = append(r.Labels, *l)
+	}
+	slices.SortFunc(r.Labels, bySize)
+
+	stats := db.Head().Stats(labels.MetricName, top)
+	r.TopLabels = stats.IndexPostingStats.CardinalityLabelStats
+	r.TopPairs = stats.IndexPostingStats.LabelValuePairsStats
+	return r, nil
+}
+
+// JobStats loads files into a temporary storage and analyzes them.
+func JobStats(files []*FileItem, opts ViewOptions, top int) (StatsReport, LoadReport, error) {
+	ts, err := OpenStorage(opts.Storage)
+	if err != nil {
+		return StatsReport{}, LoadReport{}, err
+	}
+	defer ts.Close()
+
+	load, _ := LoadFiles(ts, files, opts, nil)
+	sources := make([][]byte, len(files))
+	for i, file := range files {
+		sources[i] = file.Data
+	}
+	stats, err := BuildStats(ts.DB, sources, top)
+	return stats, load, err
+}
+
+// sourceBytes attributes every line of data to its metric, HELP and TYPE
+// lines included, and the name="value" pairs of sample lines to their label
+// names. It returns the bytes of the other lines.
+func sourceBytes(data []byte, metric, label func(name string, n int64)) int64 {
+	var overhead int64
+	symbols := labels.NewSymbolTable()
+	var lset labels.Labels
+	reader := bufio.NewReader(bytes.NewReader(data))
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			n := int64(len(line))
+			trimmed := bytes.TrimRight(line, "\r\n")
+			switch fields := bytes.Fields(trimmed); {
+			case len(fields) == 0:
+				overhead += n
+			case trimmed[0] == '#':
+				if len(fields) >= 3 && (string(fields[1]) == "HELP" || string(fields[1]) == "TYPE") {
+					metric(string(fields[2]), n)
+				} else {
+					overhead += n
+				}
+			default:
+				parser := textparse.NewPromParser(append(trimmed, '\n'), symbols, false)
+				if entry, err := parser.Next(); err != nil || entry != textparse.EntrySeries {
+					overhead += n
+					break
+				}
+				parser.Labels(&lset)
+				metric(lset.Get(labels.MetricName), n)
+				lset.Range(func(l labels.Label) {
+					if l.Name != labels.MetricName {
+						// name="value" and the separating comma
+						label(l.Name, int64(len(l.Name)+len(l.Value)+4))
+					}
+				})
+			}
+		}
+		if err != nil {
+			return overhead
+		}
+	}
+}
+
+// Format renders the report as text, top rows per section.
+func (r StatsReport) Format(top int) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%d series, %d samples, %s of source (%s scrape headers and comments)\n",
+		r.Series, r.Samples, FormatValue(float64(r.Bytes), "bytes"), FormatValue(float64(r.Overhead), "bytes"))
+
+	share := func(n int64) string {
+		if r.Bytes == 0 {
+			return "-"
+		}
+		return fmt.Sprintf("%.1f%%", float64(n)/float64(r.Bytes)*100)
+	}
+	width := func(stats []NameStats, title string) int {
+		w := len(title)
+		for _, s := range stats[:min(top, len(stats))] {
+			w = max(w, len(s.Name))
+		}
+		return w
+	}
+
+	w := width(r.Metrics, "metric")
+	fmt.Fprintf(&sb, "\n%-*s %8s %10s %10s %6s\n", w, "metric", "series", "samples", "bytes", "share")
+	for _, m := range r.Metrics[:min(top, len(r.Metrics))] {
+		fmt.Fprintf(&sb, "%-*s %8d %10d %10s %6s\n", w, m.Name, m.Series, m.Samples, FormatValue(float64(m.Bytes), "bytes"), share(m.Bytes))
+	}
+	if len(r.Metrics) > top {
+		fmt.Fprintf(&sb, "... %d more metrics\n", len(r.Metrics)-top)
+	}
+
+	w = width(r.Labels, "label")
+	fmt.Fprintf(&sb, "\n%-*s %8s %8s %10s %10s %6s\n", w, "label", "values", "series", "samples", "bytes", "share")
+	for _, l := range r.Labels[:min(top, len(r.Labels))] {
+		fmt.Fprintf(&sb, "%-*s %8d %8d %10d %10s %6s\n", w, l.Name, l.Values, l.Series, l.Samples, FormatValue(float64(l.Bytes), "bytes"), share(l.Bytes))
+	}
+	if len(r.Labels) > top {
+		fmt.Fprintf(&sb, "... %d more labels\n", len(r.Labels)-top)
+	}
+
+	writeStats := func(title, unit string, stats []index.Stat) {
+		fmt.Fprintf(&sb, "\n%s\n", title)
+		for _, s := range stats[:min(top, len(stats))] {
+			fmt.Fprintf(&sb, "%10d %s  %s\n", s.Count, unit, s.Name)
+		}
+	}
+	writeStats("highest cardinality labels", "values", r.TopLabels)
+	writeStats("label pairs with the most series", "series", r.TopPairs)
+	return sb.String()
+}
@@ -0,0 +1,112 @@
+package querier
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/prometheus/prometheus/tsdb"
+)
+
+// StorageOptions tunes the TSDB jobs are loaded into.
+type StorageOptions struct {
+	// Dir is where the session's temporary directory is created, the system
+	// temp dir if empty.
+	Dir string
+	// OutOfOrderWindow accepts samples older than the newest sample of
+	// their series when they are at most this far behind the newest sample
+	// of the storage, any series, instead of rejecting them.
+	OutOfOrderWindow time.Duration
+	// SamplesPerChunk is the target number of samples per head chunk.
+	SamplesPerChunk int
+}
+
+var DefaultStorageOptions = StorageOptions{
+	SamplesPerChunk: tsdb.DefaultSamplesPerChunk,
+}
+
+// blockDuration is large enough that a job never spans more than one block,
+// so the head accepts every sample regardless of how long the job ran.
+const blockDuration = int64(10 * 365 * 24 * time.Hour / time.Millisecond)
+
+// Storage is a head-only TSDB living in a temporary directory. Full head
+// chunks are memory-mapped from disk, so only the open chunk of each series
+// stays in memory. Close removes the directory.
+type Storage struct {
+	*tsdb.DB
+	dir       string
+	closeOnce sync.Once
+	closeErr  error
+}
+
+var (
+	openStoragesMu sync.Mutex
+	openStorages   = map[*Storage]struct{}{}
+)
+
+func OpenStorage(opts StorageOptions) (*Storage, error) {
+	dir, err := os.MkdirTemp(opts.Dir, "eph-")
+	if err != nil {
+		return nil, fmt.Errorf("creating storage directory: %w", err)
+	}
+
+	tsdbOpts := tsdb.DefaultOptions()
+	tsdbOpts.WALSegmentSize = -1 // nothing to recover, skip the WAL
+	tsdbOpts.RetentionDuration = 0
+	tsdbOpts.MinBlockDuration = blockDuration
+	tsdbOpts.MaxBlockDuration = blockDuration
+	tsdbOpts.IsolationDisabled = true
+	tsdbOpts.EnableNativeHistograms = true
+	tsdbOpts.OutOfOrderTimeWindow = opts.OutOfOrderWindow.Milliseconds()
+	if opts.SamplesPerChunk > 0 {
+		tsdbOpts.SamplesPerChunk = opts.SamplesPerChunk
+	}
+
+	db, err := tsdb.Open(dir, nil, nil, tsdbOpts, nil)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("opening storage: %w", err)
+	}
+	db.DisableCompactions()
+
+	s := &Storage{DB: db, dir: dir}
+	openStoragesMu.Lock()
+	openStorages[s] = struct{}{}
+	openStoragesMu.Unlock()
+	return s, nil
+}
+
+// Close closes the TSDB and removes its directory. It is safe to call more
+// than once.
+func (s *Storage) Close() error {
+	s.closeOnce.Do(func() {
+		openStoragesMu.Lock()
+		delete(openStorages, s)
+		openStoragesMu.Unlock()
+
+		s.closeErr = s.DB.Close()
+		if err := os.RemoveAll(s.dir); err != nil && s.closeErr == nil {
+			s.closeErr = err
+		}
+	})
+	return s.closeErr
+}
+
+// CloseStorages closes every storage still open, so temporary directories
+// are removed even when the UI is quit without leaving the query view.
+func CloseStorages() {
+	openStoragesMu.Lock()
+	storages := make([]*Storage, 0, len(openStorages))
+	for s := range openStorages {
+		storages = append(storages, s)
+	}
+	openStoragesMu.Unlock()
+
+	for _, s := range storages {
+		if err := s.Close(); err != nil {
+			log.Printf("failed to close storage: %v", err)
+		}
+	}
+}
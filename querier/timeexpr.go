@@ -0,0 +1,151 @@
+package querier
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/model"
+)
+
+// InitialQuery is the query mode and times a session starts with, as given
+// on the command line. Times are ParseTime expressions resolved once the
+// jobs are loaded, empty ones keep the session defaults.
+type InitialQuery struct {
+	Mode             string
+	Time, Start, End string
+	Step             time.Duration
+}
+
+// TimeAnchors are the instants time expressions can refer to by name.
+type TimeAnchors struct {
+	Now time.Time
+	// Start and End are the query interval of the session
+	Start, End time.Time
+	// JobStart and JobEnd are the first and last samples loaded
+	JobStart, JobEnd time.Time
+}
+
+// SessionAnchors returns the anchors of a query session over storage
+// holding samples between minTime and maxTime (ms).
+func SessionAnchors(status *TerminalStatus, minTime, maxTime int64) TimeAnchors {
+	return TimeAnchors{
+		Now:      time.Now(),
+		Start:    status.intervalStart,
+		End:      status.intervalEnd,
+		JobStart: time.UnixMilli(minTime),
+		JobEnd:   time.UnixMilli(maxTime),
+	}
+}
+
+// ParseTime parses a point in time given as unix milliseconds, RFC3339, or
+// an anchor (now, start, end, jobstart, jobend) optionally moved by a
+// duration: now-1h, start+5m, jobend-30s.
+func ParseTime(s string, anchors TimeAnchors) (time.Time, error) {
+	if ms, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.UnixMilli(ms), nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+
+	name, offset := s, ""
+	if i := strings.IndexAny(s, "+-"); i >= 0 {
+		name, offset = s[:i], s[i:]
+	}
+	var t time.Time
+	switch name {
+	case "now":
+		t = anchors.Now
+	case "start":
+		t = anchors.Start
+	case "end":
+		t = anchors.End
+	case "jobstart":
+		t = anchors.JobStart
+	case "jobend":
+		t = anchors.JobEnd
+	default:
+		return time.Time{}, fmt.Errorf("invalid time %q, use unix ms, RFC3339 or now/start/end/jobstart/jobend[+-duration]", s)
+	}
+	if offset == "" {
+		return t, nil
+	}
+
+	d, err := ParseDuration(offset[1:])
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q: %w", s, err)
+	}
+	if offset[0] == '-' {
+		d = -d
+	}
+	return t.Add(d), nil
+}
+
+// ParseDuration parses a Prometheus duration such as 30s, 5m or 1h30m, or a
+// number of seconds.
+func ParseDuration(s string) (time.Duration, error) {
+	if secs, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Duration(secs) * time.Second, nil
+	}
+	d, err := model.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q, use e.g. 30s, 5m, 1h30m or seconds", s)
+	}
+	return time.Duration(d), nil
+}
+
+// DurationFlag is a flag.Value accepting what ParseDuration does.
+type DurationFlag time.Duration
+
+func (d *DurationFlag) String() string {
+	return time.Duration(*d).String()
+}
+
+func (d *DurationFlag) Set(s string) error {
+	v, err := ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = DurationFlag(v)
+	return nil
+}
+
+// fitPoints is the number of points a range query over the whole data should
+// return, about what a graph pane can show.
+const fitPoints = 250
+
+// niceSteps are the steps FitStep picks from.
+var niceSteps = []time.Duration{
+	time.Second, 5 * time.Second, 10 * time.Second, 15 * time.Second, 30 * time.Second,
+	time.Minute, 2 * time.Minute, 5 * time.Minute, 10 * time.Minute, 15 * time.Minute, 30 * time.Minute,
+	time.Hour, 2 * time.Hour, 6 * time.Hour, 12 * time.Hour, 24 * time.Hour,
+}
+
+// FitStep returns the smallest round step giving at most fitPoints points
+// over span.
+func FitStep(span time.Duration) time.Duration {
+	for _, step := range niceSteps {
+		if span/step <= fitPoints {
+			return step
+		}
+	}
+	return niceSteps[len(niceSteps)-1]
+}
+
+// FitRange sets the query interval of status to the data bounds minTime and
+// maxTime (ms), with a step from FitStep, and the instant query time to the
+// last sample. It reports false and leaves status alone when there is no
+// data.
+func FitRange(status *TerminalStatus, minTime, maxTime int64) bool {
+	if minTime > maxTime {
+		// Empty head
+		return false
+	}
+	status.intervalStart = time.UnixMilli(minTime)
+	status.intervalEnd = time.UnixMilli(maxTime)
+	status.interval = FitStep(status.intervalEnd.Sub(status.intervalStart))
+	status.instantTime = status.intervalEnd
+	return true
+}
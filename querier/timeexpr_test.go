@@ -0,0 +1,86 @@
+package querier
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTime(t *testing.T) {
+	anchors := TimeAnchors{
+		Now:      time.Date(2025, 8, 10, 12, 0, 0, 0, time.UTC),
+		Start:    time.Date(2025, 8, 10, 10, 0, 0, 0, time.UTC),
+		End:      time.Date(2025, 8, 10, 11, 0, 0, 0, time.UTC),
+		JobStart: time.Date(2025, 8, 9, 8, 0, 0, 0, time.UTC),
+		JobEnd:   time.Date(2025, 8, 9, 9, 30, 0, 0, time.UTC),
+	}
+	tests := []struct {
+		expr string
+		want time.Time
+		ok   bool
+	}{
+		{"1754335979103", time.UnixMilli(1754335979103), true},
+		{"0", time.UnixMilli(0), true},
+		{"2025-08-04T19:32:59Z", time.Date(2025, 8, 4, 19, 32, 59, 0, time.UTC), true},
+		{"2025-08-04T21:32:59+02:00", time.Date(2025, 8, 4, 19, 32, 59, 0, time.UTC), true},
+		{"now", anchors.Now, true},
+		{"now-1h", anchors.Now.Add(-time.Hour), true},
+		{"start+5m", anchors.Start.Add(5 * time.Minute), true},
+		{"end-90", anchors.End.Add(-90 * time.Second), true},
+		{"jobstart+1h30m", anchors.JobStart.Add(90 * time.Minute), true},
+		{"jobend", anchors.JobEnd, true},
+		{"jobend-1d", anchors.JobEnd.Add(-24 * time.Hour), true},
+		{"", time.Time{}, false},
+		{"yesterday", time.Time{}, false},
+		{"now-", time.Time{}, false},
+		{"now-1x", time.Time{}, false},
+		{"now+-1h", time.Time{}, false},
+		{"2025-08-04", time.Time{}, false},
+	}
+	for _, tt := range tests {
+		got, err := ParseTime(tt.expr, anchors)
+		if (err == nil) != tt.ok || !got.Equal(tt.want) {
+			t.Errorf("ParseTime(%q) = %s, %v, want %s, ok %v", tt.expr, got, err, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		expr string
+		want time.Duration
+		ok   bool
+	}{
+		{"30s", 30 * time.Second, true},
+		{"5m", 5 * time.Minute, true},
+		{"1h30m", 90 * time.Minute, true},
+		{"1d", 24 * time.Hour, true},
+		{"1w", 7 * 24 * time.Hour, true},
+		{"500ms", 500 * time.Millisecond, true},
+		{"300", 300 * time.Second, true},
+		{"0", 0, true},
+		{"", 0, false},
+		{"1.5h", 0, false},
+		{"5 m", 0, false},
+		{"-5m", 0, false},
+		{"m", 0, false},
+	}
+	for _, tt := range tests {
+		got, err := ParseDuration(tt.expr)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("ParseDuration(%q) = %s, %v, want %s, ok %v", tt.expr, got, err, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestDurationFlag(t *testing.T) {
+	var d DurationFlag
+	if err := d.Set("2m"); err != nil || time.Duration(d) != 2*time.Minute {
+		t.Errorf("Set(2m) = %s, %v", time.Duration(d), err)
+	}
+	if err := d.Set("soon"); err == nil {
+		t.Error("Set(soon) succeeded, want an error")
+	}
+	if d.String() != "2m0s" {
+		t.Errorf("String() = %s after a failed Set, want 2m0s", d.String())
+	}
+}
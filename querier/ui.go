@@ -2,17 +2,20 @@ package querier
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"jcosta/ephemeral-prom/bucket"
 	"log"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
-	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/gdamore/tcell/v2"
 	"github.com/prometheus/prometheus/promql"
 	"github.com/prometheus/prometheus/tsdb"
-	"github.com/prometheus/prometheus/util/teststorage"
 	"github.com/rivo/tview"
 )
 
@@ -24,7 +27,31 @@ _/ __ \ \____ \ |  |  \
      \/ |__|         \/ 
 `
 
-func OpenUI(bucket string, files []FileItem, s3client s3.Client) {
+var fileTableHeaders = []string{" Name", "Job", "Size (bytes)", "Last Modified", "Data range", "Series", "Samples", "Downloaded"}
+
+const downloadedCol = 7
+
+// UIOptions holds the querier flags that shape the TUI.
+type UIOptions struct {
+	// Folders browses bucket prefixes as folders
+	Folders bool
+	// AlignMetric is the marker metric used by comparison mode
+	AlignMetric string
+	Limits      QueryLimits
+	Storage     StorageOptions
+	Sort        bool
+	// Cache keeps downloads across runs, nil when disabled
+	Cache   *Cache
+	History *History
+	Initial InitialQuery
+}
+
+// ViewOptions returns the options of a query view opened from the table.
+func (o UIOptions) ViewOptions() ViewOptions {
+	return ViewOptions{Limits: o.Limits, Storage: o.Storage, Sort: o.Sort, History: o.History, Initial: o.Initial}
+}
+
+func OpenUI(b bucket.Bucket, prefix string, files []FileItem, uiOpts UIOptions) {
 	fmt.Println("start tview")
 	screen, err := tcell.NewScreen()
 	if err != nil {
@@ -42,31 +69,107 @@ func OpenUI(bucket string, files []FileItem, s3client s3.Client) {
 	table.
 		SetBorders(false).
 		SetSelectable(true, false).
-		SetBorder(true).
-		SetTitle(fmt.Sprintf("  [grey]bucket: [orange]%s [blue](%d)  ", bucket, len(files)))
+		SetBorder(true)
 
-	headers := []string{" Name", "Size (bytes)", "Last Modified", "Downloaded"}
-	for i, h := range headers {
-		table.SetCell(0, i,
-			tview.NewTableCell(fmt.Sprintf("[orange]%s", h)).
-				SetSelectable(false).
-				SetAlign(tview.AlignLeft))
+	for i := range files {
+		files[i].Cached = uiOpts.Cache.Has(b.Name(), &files[i])
 	}
 
-	for r, file := range files {
-		status := "-"
-		if len(file.Data) > 0 {
-			status = "Downloaded"
+	dir := prefix
+	filter := ""
+	var entries []TableEntry
+	var selection []*FileItem
+
+	renderTable := func() {
+		entries = ListEntries(files, prefix, dir, uiOpts.Folders, filter)
+		table.Clear()
+		table.SetTitle(fmt.Sprintf("  [grey]bucket: [orange]%s/%s [blue](%d)  ", b.Name(), dir, len(entries)))
+
+		for i, h := range fileTableHeaders {
+			table.SetCell(0, i,
+				tview.NewTableCell(fmt.Sprintf("[orange]%s", h)).
+					SetSelectable(false).
+					SetAlign(tview.AlignLeft))
+		}
+
+		for r, entry := range entries {
+			values := make([]string, len(fileTableHeaders))
+			for i := range values {
+				values[i] = "-"
+			}
+
+			if entry.File == nil {
+				name := strings.TrimPrefix(entry.Folder, dir)
+				if len(entry.Folder) < len(dir) {
+					name = ".."
+				}
+				values[0] = fmt.Sprintf(" [blue]%s", name)
+			} else {
+				file := entry.File
+				values[0] = fmt.Sprintf(" %s", strings.TrimPrefix(file.Name, dir))
+				if slices.Contains(selection, file) {
+					values[0] = fmt.Sprintf(" [green]✓ %s", strings.TrimPrefix(file.Name, dir))
+				}
+				if jobName := file.Metadata["job_name"]; jobName != "" {
+					values[1] = jobName
+				}
+				values[2] = fmt.Sprintf("%d", file.Size)
+				values[3] = file.Date.Format(time.RFC3339)
+				if m := file.Manifest; m != nil {
+					if m.JobName != "" {
+						values[1] = m.JobName
+					}
+					values[4] = fmt.Sprintf("%s +%s",
+						time.UnixMilli(m.MinTime).Format(time.RFC3339),
+						time.Duration(m.MaxTime-m.MinTime)*time.Millisecond)
+					values[5] = strconv.Itoa(m.Series)
+					values[6] = strconv.Itoa(m.Samples)
+				}
+				if len(file.Data) > 0 {
+					values[downloadedCol] = "Downloaded"
+				} else if file.Cached {
+					values[downloadedCol] = "Cached"
+				}
+			}
+
+			for i, v := range values {
+				expansion := 50
+				if i == 0 {
+					expansion = 100
+				}
+				table.SetCell(r+1, i, tview.NewTableCell(v).SetExpansion(expansion))
+			}
+		}
+		if row, _ := table.GetSelection(); row < 1 || row > len(entries) {
+			table.Select(1, 0)
 		}
-		table.SetCell(r+1, 0, tview.NewTableCell(fmt.Sprintf(" %s", file.Name)).SetExpansion(100))
-		table.SetCell(r+1, 1, tview.NewTableCell(fmt.Sprintf("%d", file.Size)).SetExpansion(50))
-		table.SetCell(r+1, 2, tview.NewTableCell(file.Date.Format(time.RFC3339)).SetExpansion(50))
-		table.SetCell(r+1, 3, tview.NewTableCell(status).SetExpansion(50))
 	}
+	renderTable()
+
+	filterField := tview.NewInputField().
+		SetLabel("/ ").
+		SetPlaceholder("filter: text, job=, metric=, label=, target=").
+		SetFieldWidth(0)
+	filterField.SetLabelColor(tcell.ColorLightGray)
+	filterField.SetChangedFunc(func(text string) {
+		filter = text
+		renderTable()
+	})
+	filterField.SetDoneFunc(func(key tcell.Key) {
+		if key == tcell.KeyEscape {
+			filterField.SetText("")
+		}
+		app.SetFocus(table)
+	})
+
+	list := tview.NewFlex().
+		SetDirection(tview.FlexRow).
+		AddItem(table, 0, 1, true).
+		AddItem(filterField, 1, 0, false)
 
-	footerText := "[::d]↑↓ Navigate   Enter View Details   Esc Quit"
+	footerText := "[::d]↑↓ Navigate   Space Select   Enter View Details   c Compare aligned   / Filter   Esc Quit"
 
-	frame := tview.NewFrame(table).
+	frame := tview.NewFrame(list).
 		SetBorders(1, 1, 1, 1, 0, 0).
 		AddText("", true, tview.AlignCenter, tcell.ColorDefault).
 		AddText(footerText, false, tview.AlignCenter, tcell.ColorGray)
@@ -75,22 +178,34 @@ func OpenUI(bucket string, files []FileItem, s3client s3.Client) {
 	pages := tview.NewPages().
 		AddPage("main", frame, true, true)
 
-	// Table selection logic
-	table.SetSelectedFunc(func(row, column int) {
-		if row == 0 {
+	onExit := func() {
+		pages.SwitchToPage("main")
+		app.SetFocus(table)
+	}
+
+	// openFiles downloads whatever isn't local yet, after confirmation, and
+	// loads all of toOpen into a single terminal view.
+	openFiles := func(toOpen []*FileItem, viewOpts ViewOptions) {
+		var missing []*FileItem
+		var missingSize int64
+		for _, file := range toOpen {
+			if len(file.Data) == 0 && !uiOpts.Cache.Load(b.Name(), file) {
+				file.Cached = false
+				missing = append(missing, file)
+				missingSize += file.Size
+			}
+		}
+		if len(missing) == 0 {
+			TerminalView(app, pages, toOpen, viewOpts, onExit)
 			return
 		}
-		file := &files[row-1]
+
 		details := fmt.Sprintf(
 			"File: %s\nSize: %d bytes\nLast Modified: %s",
-			file.Name, file.Size, file.Date.Format(time.RFC3339),
+			missing[0].Name, missing[0].Size, missing[0].Date.Format(time.RFC3339),
 		)
-		if len(file.Data) > 0 {
-			TerminalView(app, pages, file, func() {
-				pages.SwitchToPage("main")
-				app.SetFocus(table)
-			})
-			return
+		if len(missing) > 1 {
+			details = fmt.Sprintf("Download %d files?\nSize: %d bytes", len(missing), missingSize)
 		}
 
 		modal := tview.NewModal().
@@ -101,13 +216,14 @@ func OpenUI(bucket string, files []FileItem, s3client s3.Client) {
 				app.SetFocus(table)
 
 				if buttonLabel == "OK" {
-					DownloadFile(bucket, file, s3client)
-					if len(file.Data) > 0 {
-						table.GetCell(row, 3).SetText("Downloaded")
-					}
-					TerminalView(app, pages, file, func() {
-						pages.SwitchToPage("main")
-						app.SetFocus(table)
+					DownloadView(app, pages, b, uiOpts.Cache, missing, func(err error) {
+						renderTable()
+						if err == nil {
+							TerminalView(app, pages, toOpen, viewOpts, onExit)
+							return
+						}
+						onExit()
+						app.SetInputCapture(nil)
 					})
 				}
 			})
@@ -124,6 +240,63 @@ func OpenUI(bucket string, files []FileItem, s3client s3.Client) {
 			}
 			return event
 		})
+	}
+
+	// Table selection logic
+	table.SetSelectedFunc(func(row, column int) {
+		if row == 0 || row > len(entries) {
+			return
+		}
+		entry := entries[row-1]
+		if entry.File == nil {
+			dir = entry.Folder
+			renderTable()
+			return
+		}
+
+		if len(selection) > 0 {
+			openFiles(selection, uiOpts.ViewOptions())
+			return
+		}
+		openFiles([]*FileItem{entry.File}, uiOpts.ViewOptions())
+	})
+
+	table.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch event.Rune() {
+		case '/':
+			app.SetFocus(filterField)
+			return nil
+		case ' ':
+			// Toggle the row in the multi-selection
+			row, _ := table.GetSelection()
+			if row == 0 || row > len(entries) || entries[row-1].File == nil {
+				return nil
+			}
+			file := entries[row-1].File
+			if i := slices.Index(selection, file); i >= 0 {
+				selection = slices.Delete(selection, i, i+1)
+			} else {
+				selection = append(selection, file)
+			}
+			renderTable()
+			return nil
+		case 'c':
+			// Compare: open the selection (or current row) time-aligned
+			toOpen := selection
+			if len(toOpen) == 0 {
+				row, _ := table.GetSelection()
+				if row == 0 || row > len(entries) || entries[row-1].File == nil {
+					return nil
+				}
+				toOpen = []*FileItem{entries[row-1].File}
+			}
+			viewOpts := uiOpts.ViewOptions()
+			viewOpts.Align = true
+			viewOpts.AlignMetric = uiOpts.AlignMetric
+			openFiles(toOpen, viewOpts)
+			return nil
+		}
+		return event
 	})
 
 	// Esc quits from table
@@ -133,12 +306,36 @@ func OpenUI(bucket string, files []FileItem, s3client s3.Client) {
 		}
 	})
 
+	// Quitting from a query view leaves its storage open
+	defer CloseStorages()
+
 	// Set up root with pages
 	if err := app.SetRoot(pages, true).EnableMouse(true).Run(); err != nil {
 		log.Fatal(err)
 	}
 }
 
+// OpenFileUI opens the query view straight on local files, leaving it quits.
+func OpenFileUI(files []*FileItem, uiOpts UIOptions) {
+	screen, err := tcell.NewScreen()
+	if err != nil {
+		log.Fatalf("Failed to create screen: %v", err)
+	}
+	if err := screen.Init(); err != nil {
+		log.Fatalf("Failed to init screen: %v", err)
+	}
+	defer screen.Fini()
+
+	app := tview.NewApplication().SetScreen(screen)
+	pages := tview.NewPages()
+	defer CloseStorages()
+	TerminalView(app, pages, files, uiOpts.ViewOptions(), app.Stop)
+
+	if err := app.SetRoot(pages, true).EnableMouse(true).Run(); err != nil {
+		log.Fatal(err)
+	}
+}
+
 type TerminalStatus struct {
 	queryMode     string
 	intervalStart time.Time
@@ -146,6 +343,23 @@ type TerminalStatus struct {
 	interval      time.Duration
 	lookbackDelta time.Duration
 	instantTime   time.Time
+	maxSamples    int
+	timeout       time.Duration
+	concurrency   int
+	// graph draws range query results in the graph pane instead of the output
+	graph bool
+	// table shows instant query vectors in the results pane instead of the
+	// output
+	table bool
+}
+
+func (s TerminalStatus) Limits() QueryLimits {
+	return QueryLimits{
+		LookbackDelta: s.lookbackDelta,
+		MaxSamples:    s.maxSamples,
+		Timeout:       s.timeout,
+		Concurrency:   s.concurrency,
+	}
 }
 
 func BuildLeftCol(db *tsdb.DB, bucket string, jobId string, date time.Time) *tview.Flex {
@@ -188,12 +402,10 @@ func BuildLeftCol(db *tsdb.DB, bucket string, jobId string, date time.Time) *tvi
 	//leftCol.SetBorder(true)
 
 	return leftCol
-} // Build once, keep a ref to the table so you can update the value cells later.
-func BuildMiddleCol(status *TerminalStatus) (*tview.Flex, *tview.Table) {
-	table := tview.NewTable().
-		SetBorders(false).
-		SetSelectable(false, false)
+}
 
+// middleColRows returns the session status rows for the current mode.
+func middleColRows(status *TerminalStatus) ([]string, []string) {
 	var labels []string
 	var values []string
 
@@ -223,6 +435,21 @@ func BuildMiddleCol(status *TerminalStatus) (*tview.Flex, *tview.Table) {
 		}
 	}
 
+	labels = append(labels, "Limits:")
+	values = append(values, fmt.Sprintf("%d samples, %s timeout, %d concurrent",
+		status.maxSamples, status.timeout, status.concurrency))
+
+	return labels, values
+}
+
+// Build once, keep a ref to the table so you can update the value cells later.
+func BuildMiddleCol(status *TerminalStatus) (*tview.Flex, *tview.Table) {
+	table := tview.NewTable().
+		SetBorders(false).
+		SetSelectable(false, false)
+
+	labels, values := middleColRows(status)
+
 	for i := range labels {
 		table.SetCell(i, 0,
 			tview.NewTableCell(labels[i]).
@@ -252,33 +479,7 @@ func UpdateMiddleCol(tbl *tview.Table, status *TerminalStatus) {
 	}
 
 	// Desired rows based on mode
-	var labels []string
-	var values []string
-	if status.queryMode == "instant" {
-		labels = []string{
-			"Current mode:",
-			"Query time:",
-			"Lookback delta:",
-		}
-		values = []string{
-			status.queryMode,
-			fmt.Sprintf("%s [blue](%d)", status.instantTime.Format(time.RFC3339), status.instantTime.UnixMilli()),
-			status.lookbackDelta.String(),
-		}
-	} else {
-		labels = []string{
-			"Current mode:",
-			"Interval start:",
-			"Interval end:",
-			"Interval:",
-		}
-		values = []string{
-			status.queryMode,
-			fmt.Sprintf("%s [blue](%d)", status.intervalStart.Format(time.RFC3339), status.intervalStart.UnixMilli()),
-			fmt.Sprintf("%s [blue](%d)", status.intervalEnd.Format(time.RFC3339), status.intervalEnd.UnixMilli()),
-			status.interval.String(),
-		}
-	}
+	labels, values := middleColRows(status)
 
 	// Decide if we can just update col=1 or must rebuild (e.g., mode flip).
 	needRebuild := tbl.GetRowCount() != len(labels)
@@ -332,16 +533,30 @@ func BuildCommandsCol() *tview.Flex {
 		"$ lookback !val",
 		"$ interval start/end !val",
 		"$ interval !val",
+		"$ fit",
 		"$ metrics !val",
+		"$ explore [!metric]",
+		"$ stats [!n]",
+		"$ limit samples/timeout/concurrency !val",
+		"$ graph / table",
+		"$ history [all] / history !n",
+		"$ tab new/close / tab !n",
 	}
 	descs := []string{
 		"exit query view",
 		"change mode",
-		"set query time to !val (unix ms)",
-		"set lookback delta to !val seconds",
-		"set interval start/end to !val (unix ms)",
-		"set interval to !val (seconds)",
+		"set query time to !val (RFC3339, unix ms, now-1h, jobend...)",
+		"set lookback delta to !val (5m, 30s...)",
+		"set interval start/end to !val (start+5m, end, jobstart...)",
+		"set interval to !val (30s, 5m...)",
+		"set interval start/end, step and time to the data",
 		"list metrics containing !val",
+		"browse metrics, labels and series",
+		"series, samples and source bytes per metric and label, top !n",
+		"set max samples, timeout (30s...) or concurrent queries",
+		"toggle graph / results table for range / instant queries",
+		"list recent / all history, or run entry !n again",
+		"open, close or switch query tabs (ctrl-t, ctrl-d, ctrl-n/ctrl-p)",
 	}
 
 	for i := range cmds {
@@ -362,139 +577,628 @@ func BuildCommandsCol() *tview.Flex {
 	//col.SetBorder(true)
 	return col
 }
-func TerminalView(app *tview.Application, pages *tview.Pages, file *FileItem, onExit func()) {
-	status := TerminalStatus{}
-	status.queryMode = "instant"
-	status.intervalEnd = file.Date
-	status.intervalStart = file.Date.Add(-1 * time.Hour)
-	status.interval = 300 * time.Second
-	status.instantTime = file.Date
-	status.lookbackDelta = 300 * time.Second
+
+// ViewOptions configures how jobs are loaded into the terminal view.
+type ViewOptions struct {
+	// Align shifts every job so it starts at t=0, or so the first sample of
+	// AlignMetric lands on t=0 when set.
+	Align       bool
+	AlignMetric string
+	// Limits are the initial query limits of the session
+	Limits  QueryLimits
+	Storage StorageOptions
+	// Sort orders samples before appending them
+	Sort bool
+	// History is shared by every query view of the process
+	History *History
+	// Initial overrides the starting mode and times of the session
+	Initial InitialQuery
+}
+
+// TerminalView loads files into a single storage and opens the query view on
+// it. When several files are loaded each sample gets an eph_job label naming
+// the file it came from, so jobs can be compared with e.g. avg by (eph_job).
+// Files are parsed in the background behind a progress page.
+func TerminalView(app *tview.Application, pages *tview.Pages, files []*FileItem, opts ViewOptions, onExit func()) {
 	app.EnableMouse(true)
-	ts, err := teststorage.NewWithError()
+	ts, err := OpenStorage(opts.Storage)
 	if err != nil {
-		log.Fatal("Failed to create storage")
+		log.Fatalf("Failed to create storage: %v", err)
 	}
 
-	appender := ts.Appender(context.Background())
-	ParseSequenceString(appender, file.Data)
+	progress := tview.NewModal().SetText("Loading...")
+	pages.AddAndSwitchToPage("loading", progress, true)
+	app.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		// Nothing to do until the load is over, but Ctrl-C still quits
+		if event.Key() == tcell.KeyCtrlC {
+			return event
+		}
+		return nil
+	})
+
+	jobLabels := JobLabels(files)
+	go func() {
+		report, notAligned := LoadFiles(ts, files, opts, func(file int, read, size int64) {
+			text := fmt.Sprintf("Loading %s (%d/%d)\n\n%s\n%d / %d bytes",
+				jobLabels[file], file+1, len(files),
+				ProgressBar(read, size, 30), read, size)
+			app.QueueUpdateDraw(func() { progress.SetText(text) })
+		})
+
+		app.QueueUpdateDraw(func() {
+			pages.RemovePage("loading")
+			openTerminal(app, pages, ts, files, opts, report, notAligned, onExit)
+		})
+	}()
+}
+
+// DownloadView downloads files behind a progress page, Esc cancels, and
+// stores them in cache (which may be nil). onDone
+// runs on the UI goroutine with nil once every file is downloaded, or with
+// the error that stopped the download, after the error was acknowledged.
+// Cache failures are shown the same way but don't fail the download. Files
+// downloaded before a cancel or failure keep their data.
+func DownloadView(app *tview.Application, pages *tview.Pages, b bucket.Bucket, cache *Cache, files []*FileItem, onDone func(err error)) {
+	var total int64
+	for _, file := range files {
+		total += file.Size
+	}
 
-	engine := promql.NewEngine(promql.EngineOpts{
-		MaxSamples:    10000,
-		Timeout:       5 * time.Second,
-		LookbackDelta: 5 * time.Minute,
+	jobLabels := JobLabels(files)
+	ctx, cancel := context.WithCancel(context.Background())
+	progress := tview.NewModal().SetText("Downloading...")
+	pages.AddAndSwitchToPage("download", progress, true)
+	app.SetFocus(progress)
+	app.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyEscape {
+			cancel()
+			return nil
+		}
+		return event
 	})
+
+	go func() {
+		defer cancel()
+
+		var done int64 // bytes of the files already downloaded
+		var err error
+		var cacheErrs []error
+		for i, file := range files {
+			err = DownloadFile(ctx, b, file, func(read int64) {
+				text := fmt.Sprintf("Downloading %s (%d/%d)\n\n%s\n%d / %d bytes\n\nEsc to cancel",
+					jobLabels[i], i+1, len(files),
+					ProgressBar(done+read, total, 30), done+read, total)
+				app.QueueUpdateDraw(func() { progress.SetText(text) })
+			})
+			if err != nil {
+				break
+			}
+			if err := cache.Store(b.Name(), file); err != nil {
+				cacheErrs = append(cacheErrs, fmt.Errorf("caching %s: %w", jobLabels[i], err))
+			}
+			file.Cached = cache.Has(b.Name(), file)
+			done += file.Size
+		}
+
+		canceled := ctx.Err() != nil
+		app.QueueUpdateDraw(func() {
+			if (err == nil || canceled) && len(cacheErrs) == 0 {
+				pages.RemovePage("download")
+				onDone(err)
+				return
+			}
+
+			// stderr is the terminal, report failures here.
+			text := fmt.Sprintf("Download failed:\n%v", err)
+			if err == nil || canceled {
+				text = fmt.Sprintf("Failed to cache:\n%v", errors.Join(cacheErrs...))
+			}
+			app.SetInputCapture(nil)
+			progress.SetText(text).
+				AddButtons([]string{"OK"}).
+				SetDoneFunc(func(int, string) {
+					pages.RemovePage("download")
+					onDone(err)
+				})
+		})
+	}()
+}
+
+// ProgressBar renders done/total as a bar width cells wide followed by the
+// percentage.
+func ProgressBar(done, total int64, width int) string {
+	ratio := 1.0
+	if total > 0 {
+		ratio = min(float64(done)/float64(total), 1)
+	}
+	filled := int(ratio * float64(width))
+	return fmt.Sprintf("%s%s %3.0f%%",
+		strings.Repeat("█", filled), strings.Repeat("░", width-filled), ratio*100)
+}
+
+// queryTab is one query session of the query view: its own mode, times,
+// output and panes over the storage shared by every tab.
+type queryTab struct {
+	id       int
+	status   *TerminalStatus
+	terminal *tview.Flex
+	output   *tview.TextView
+	input    *QueryInput
+	// last is the last query run, it names the tab
+	last string
+}
+
+// openTerminal builds the query view on a loaded storage.
+func openTerminal(app *tview.Application, pages *tview.Pages, ts *Storage, files []*FileItem, opts ViewOptions, report LoadReport, notAligned []string, onExit func()) {
+	date := files[0].Date
+	for _, file := range files {
+		if file.Date.After(date) {
+			date = file.Date
+		}
+	}
+	jobs := JobLabels(files)
+
+	status := TerminalStatus{}
+	status.queryMode = "instant"
+	status.intervalEnd = date
+	status.intervalStart = date.Add(-1 * time.Hour)
+	status.interval = 300 * time.Second
+	status.instantTime = date
+	status.lookbackDelta = opts.Limits.LookbackDelta
+	status.maxSamples = opts.Limits.MaxSamples
+	status.timeout = opts.Limits.Timeout
+	status.concurrency = opts.Limits.Concurrency
+	status.graph = true
+	status.table = true
+
+	// Query the loaded samples, aligned jobs included since they live at
+	// t=0. The file date above is only a fallback for empty jobs.
+	FitRange(&status, ts.Head().MinTime(), ts.Head().MaxTime())
+
+	engine := NewQueryEngine()
+	// Queries run in the background so the UI stays responsive, exit
+	// cancels them and closes the storage once they're done. Never Wait on
+	// the UI goroutine, they finish with a blocking QueueUpdateDraw.
+	queryCtx, cancelQueries := context.WithCancel(context.Background())
+	var running sync.WaitGroup
+	// updateDraw drops the results of queries and stats cancelled by exit.
+	updateDraw := func(f func()) {
+		if queryCtx.Err() == nil {
+			app.QueueUpdateDraw(f)
+		}
+	}
 	middleFlex, middleTable := BuildMiddleCol(&status)
-	outputView := tview.NewTextView().
-		SetDynamicColors(true).
-		SetScrollable(true)
-	outputView.
-		SetChangedFunc(func() { outputView.ScrollToEnd(); app.Draw() })
-
-	inputField := tview.NewInputField()
-	inputField.SetLabelColor(tcell.ColorLightGray)
-	inputField.
-		SetLabel("> ").SetPlaceholder("enter command, promql query or press tab to enter scroll mode").
-		SetFieldWidth(0).
-		SetDoneFunc(func(key tcell.Key) {
-			if key == tcell.KeyEnter {
-				cmd := inputField.GetText()
-				if cmd == "" {
-					return
+
+	history := opts.History
+	if history == nil {
+		history, _ = LoadHistory("")
+	}
+
+	// Tabs keep several query sessions side by side, the header shows the
+	// status of the active one.
+	var tabs []*queryTab
+	active := 0
+	// The storage doesn't change after loading, every tab's explorer
+	// shares one count of series per metric, taken on the first explore.
+	seriesCounts := sync.OnceValues(func() (map[string]int, error) {
+		return MetricSeriesCounts(ts.DB)
+	})
+	// Completion runs in the active tab, stderr would garble the screen.
+	completer := NewCompleter(ts.DB, func(err error) {
+		tabs[active].output.Write([]byte(fmt.Sprintf("\n[red]completion: %v\n", err)))
+	})
+	nextTabID := 0
+	tabBar := tview.NewTextView().SetDynamicColors(true).SetWrap(false)
+	tabPages := tview.NewPages()
+	var openTab func(status TerminalStatus) *queryTab
+	var switchTab func(i int)
+	var closeTab func(i int)
+
+	newTab := func(status TerminalStatus) *queryTab {
+		nextTabID++
+		tab := &queryTab{id: nextTabID, status: &status}
+		terminal := tview.NewFlex()
+		graph := NewGraph()
+		inputField := NewQueryInput()
+		results := NewResultTable(
+			func(p tview.Primitive) { app.SetFocus(p) },
+			func(selector string) {
+				inputField.SetText(selector)
+				app.SetFocus(inputField)
+			})
+		outputView := tview.NewTextView().
+			SetDynamicColors(true).
+			SetScrollable(true)
+		outputView.
+			SetChangedFunc(func() { outputView.ScrollToEnd(); app.Draw() })
+		explorer := NewExplorer(ts.DB, seriesCounts,
+			func(p tview.Primitive) { app.SetFocus(p) },
+			func(query string) {
+				inputField.SetText(query)
+				app.SetFocus(inputField)
+			},
+			func() { app.SetFocus(inputField) },
+			func(err error) {
+				outputView.Write([]byte(fmt.Sprintf("\n[red]explorer: %v\n", err)))
+			})
+
+		// The graph, results and explorer panes share the space above the
+		// output, at most one of them is shown.
+		var shownPane tview.Primitive
+		showPane := func(p tview.Primitive) {
+			terminal.ResizeItem(graph, 0, 0)
+			terminal.ResizeItem(results, 0, 0)
+			terminal.ResizeItem(explorer, 0, 0)
+			if p != nil {
+				terminal.ResizeItem(p, 0, 2)
+			}
+			shownPane = p
+		}
+
+		// histPos is the history entry shown in the input line while browsing
+		// with Up/Down or searching with Ctrl-R, -1 otherwise.
+		histPos := -1
+		searching := false
+		searchTerm := ""
+
+		// historyCommand lists the latest history entries, or all of them, or
+		// returns the entry to run again.
+		historyCommand := func(args []string) (string, bool) {
+			entries := history.Entries()
+			switch {
+			case len(args) == 0 || len(args) == 1 && args[0] == "all":
+				first := 0
+				if len(args) == 0 {
+					first = max(len(entries)-historyListed, 0)
+				}
+				outputView.Write([]byte("\n"))
+				for i := first; i < len(entries); i++ {
+					outputView.Write([]byte(fmt.Sprintf("[grey]%4d[-]  %s\n", i+1, tview.Escape(entries[i]))))
+				}
+				return "", false
+			case len(args) == 1:
+				if n, err := strconv.Atoi(args[0]); err == nil && n >= 1 && n <= len(entries) {
+					return entries[n-1], true
 				}
-				outputView.Write([]byte(fmt.Sprintf("[orange]$ %s", cmd)))
-				inputField.SetText("")
+			}
+			outputView.Write([]byte("\n[green] invalid arguments\n"))
+			return "", false
+		}
 
-				parsedCommand := ProcessCommand(cmd, ts.DB, &status, outputView)
+		// submit runs the command or query in the input line.
+		submit := func() {
+			cmd := strings.TrimSpace(inputField.GetText())
+			if cmd == "" || inputField.ParseError() != nil {
+				// Parse errors are already marked above the input
+				return
+			}
+			outputView.Write([]byte(fmt.Sprintf("[orange]$ %s", cmd)))
+			inputField.SetText("")
+			histPos = -1
 
-				// already handled by ProcessCommand
-				if parsedCommand == "metrics" {
+			if fields := strings.Fields(cmd); fields[0] == "history" {
+				entry, ok := historyCommand(fields[1:])
+				if !ok {
 					return
 				}
+				cmd = entry
+				outputView.Write([]byte(fmt.Sprintf("\n[orange]$ %s", cmd)))
+			}
+			if err := history.Add(cmd); err != nil {
+				outputView.Write([]byte(fmt.Sprintf("\n[red]failed to save history: %v", err)))
+			}
 
-				if parsedCommand == "exit" {
-					app.SetInputCapture(nil)
+			parsedCommand := ProcessCommand(cmd, ts.DB, &status, outputView)
+
+			// already handled by ProcessCommand
+			if parsedCommand == "metrics" {
+				return
+			}
+
+			if parsedCommand == "exit" {
+				app.SetInputCapture(nil)
+				cancelQueries()
+				go func() {
+					running.Wait()
 					ts.Close()
-					onExit()
-				}
+				}()
+				onExit()
+				return
+			}
 
-				if parsedCommand != "" {
-					UpdateMiddleCol(middleTable, &status)
-					//appp.Draw()
-					outputView.Write([]byte(fmt.Sprintf("\n[green] %s\n", parsedCommand)))
-					return
+			switch parsedCommand {
+			case "graph on":
+				if graph.Len() > 0 {
+					showPane(graph)
 				}
-
-				var (
-					query promql.Query
-					err   error
-				)
-				if status.queryMode == "instant" {
-					query, err = engine.NewInstantQuery(
-						context.Background(),
-						ts,
-						nil,
-						cmd,
-						status.instantTime,
-					)
-				} else {
-					query, err = engine.NewRangeQuery(
-						context.Background(),
-						ts,
-						nil,
-						cmd,
-						status.intervalStart,
-						status.intervalEnd,
-						status.interval,
-					)
+			case "table on":
+				if results.Len() > 0 {
+					showPane(results)
 				}
-				if err != nil {
-					outputView.Write([]byte(fmt.Sprintf("\n[green]%v\n", err)))
+			case "graph off", "table off":
+				if shownPane == graph && !status.graph || shownPane == results && !status.table {
+					showPane(nil)
 				}
-				response := "--no response--"
+			case "explore":
+				if shownPane == explorer {
+					showPane(nil)
+					break
+				}
+				explorer.Load()
+				showPane(explorer)
+				app.SetFocus(explorer)
+			case "tab new":
+				openTab(status)
+				return
+			case "tab close":
+				closeTab(active)
+				return
+			}
+			if top, ok := strings.CutPrefix(parsedCommand, "stats "); ok {
+				n, _ := strconv.Atoi(top)
+				sources := make([][]byte, len(files))
+				for i, file := range files {
+					sources[i] = file.Data
+				}
+				outputView.Write([]byte("\n[grey]analyzing..."))
+				running.Add(1)
+				go func() {
+					defer running.Done()
+					report, err := BuildStats(ts.DB, sources, n)
+					updateDraw(func() {
+						if err != nil {
+							outputView.Write([]byte(fmt.Sprintf("\n[red]stats failed: %v\n", err)))
+							return
+						}
+						outputView.Write([]byte(fmt.Sprintf("\n[white]%s", tview.Escape(report.Format(n)))))
+					})
+				}()
+				return
+			}
+			if metric, ok := strings.CutPrefix(parsedCommand, "explore "); ok {
+				explorer.SelectMetric(metric)
+				showPane(explorer)
+				app.SetFocus(explorer)
+			}
+			if n, ok := strings.CutPrefix(parsedCommand, "tab "); ok {
+				i, _ := strconv.Atoi(n)
+				if i < 1 || i > len(tabs) {
+					outputView.Write([]byte(fmt.Sprintf("\n[green] no tab %d\n", i)))
+					return
+				}
+				switchTab(i - 1)
+				return
+			}
+
+			if parsedCommand != "" {
+				UpdateMiddleCol(middleTable, &status)
+				//appp.Draw()
+				outputView.Write([]byte(fmt.Sprintf("\n[green] %s\n", parsedCommand)))
+				return
+			}
+
+			tab.last = cmd
+			renderTabs(tabBar, tabs, active)
+			queryStatus := status
+			running.Add(1)
+			go func() {
+				defer running.Done()
+				res := engine.Exec(queryCtx, ts, queryStatus, cmd, func() {
+					updateDraw(func() {
+						outputView.Write([]byte("\n[grey]queued, waiting for a free query slot..."))
+					})
+				})
 
-				if query != nil {
-					res := query.Exec(context.Background())
+				response := "--no response--"
+				if res.Err == nil && len(res.Value.String()) > 0 {
+					response = res.Value.String()
+				}
+				updateDraw(func() {
 					if res.Err != nil {
 						outputView.Write([]byte(fmt.Sprintf("\n[green]%v\n", res.Err)))
+						if hint := LimitHint(res.Err, queryStatus.Limits()); hint != "" {
+							outputView.Write([]byte(fmt.Sprintf("[red]%s\n", hint)))
+						}
 						return
 					}
-
-					if len(res.Value.String()) > 0 {
-						response = res.Value.String()
+					if matrix, ok := res.Value.(promql.Matrix); ok && queryStatus.queryMode == "range" && queryStatus.graph {
+						graph.SetData(matrix, queryStatus.intervalStart, queryStatus.intervalEnd, queryStatus.interval)
+						showPane(graph)
+						outputView.Write([]byte(fmt.Sprintf("\n[grey]graphed %d series, \"graph\" switches to text output\n", len(matrix))))
+						return
+					}
+					if vector, ok := res.Value.(promql.Vector); ok && queryStatus.table && len(vector) > 0 {
+						results.SetVector(vector)
+						showPane(results)
+						outputView.Write([]byte(fmt.Sprintf("\n[grey]%d samples in the results table, tab to browse, \"table\" switches to text output\n", len(vector))))
+						return
 					}
 					outputView.Write([]byte(fmt.Sprintf("\n[green]%s\n", response)))
+				})
+			}()
+		}
+
+		completionPrefix := ""
+		inputField.SetLabelColor(tcell.ColorLightGray)
+		inputField.
+			SetLabel("> ").SetPlaceholder("enter command, promql query or press tab to enter scroll mode").
+			SetFieldWidth(0).
+			SetAutocompleteFunc(func(text string) []string {
+				if histPos >= 0 && text == history.Entries()[histPos] {
+					// Recalled from history, nothing is being typed
+					return nil
+				}
+				prefix, entries := completer.Complete(text)
+				completionPrefix = prefix
+				return entries
+			}).
+			SetAutocompletedFunc(func(text string, index, source int) bool {
+				switch source {
+				case tview.AutocompletedTab, tview.AutocompletedClick:
+					inputField.SetText(completionPrefix + text)
+					return true
+				case tview.AutocompletedEnter:
+					// Enter runs what was typed, Tab picks a completion
+					submit()
+					return true
+				}
+				return false
+			}).
+			SetDoneFunc(func(key tcell.Key) {
+				if key == tcell.KeyEnter {
+					submit()
 				}
 
+				if key == tcell.KeyTAB {
+					if shownPane == results || shownPane == explorer {
+						app.SetFocus(shownPane)
+						return
+					}
+					app.SetFocus(outputView)
+				}
+			})
+		inputField.SetInputCapture(func(ev *tcell.EventKey) *tcell.EventKey {
+			entries := history.Entries()
+			showEntry := func(i int) {
+				histPos = i
+				inputField.SetText(entries[i])
+			}
+			browsing := histPos >= 0 && inputField.GetText() == entries[histPos]
+			if searching && ev.Key() != tcell.KeyCtrlR {
+				searching = false
+				inputField.SetLabel("> ")
 			}
 
-			if key == tcell.KeyTAB {
+			switch ev.Key() {
+			case tcell.KeyUp:
+				// Up recalls history unless a query is being typed, which
+				// leaves it to the autocomplete list
+				if len(entries) > 0 && (inputField.GetText() == "" || browsing) {
+					if browsing {
+						showEntry(max(histPos-1, 0))
+					} else {
+						showEntry(len(entries) - 1)
+					}
+					return nil
+				}
+			case tcell.KeyDown:
+				if browsing {
+					if histPos+1 < len(entries) {
+						showEntry(histPos + 1)
+					} else {
+						histPos = -1
+						inputField.SetText("")
+					}
+					return nil
+				}
+			case tcell.KeyCtrlR:
+				// Search back for the typed text, again for older matches
+				from := len(entries)
+				if searching {
+					from = histPos
+				} else {
+					searching = true
+					searchTerm = inputField.GetText()
+				}
+				if i, ok := history.Search(searchTerm, from); ok {
+					showEntry(i)
+					inputField.SetLabel(fmt.Sprintf("(search `%s`) > ", tview.Escape(searchTerm)))
+				} else {
+					inputField.SetLabel(fmt.Sprintf("[red](failed search `%s`)[-] > ", tview.Escape(searchTerm)))
+				}
+				return nil
+			}
+			return ev
+		})
+		results.SetInputCapture(func(ev *tcell.EventKey) *tcell.EventKey {
+			switch ev.Key() {
+			case tcell.KeyTab:
 				app.SetFocus(outputView)
+				return nil
+			case tcell.KeyBacktab:
+				app.SetFocus(inputField)
+				return nil
 			}
+			return ev
 		})
-	outputView.SetInputCapture(func(ev *tcell.EventKey) *tcell.EventKey {
-		switch ev.Key() {
-		case tcell.KeyTab:
-			// From output -> input
-			app.SetFocus(inputField)
-			return nil
-		case tcell.KeyBacktab:
-			// If you want Shift+Tab to also go to input
-			app.SetFocus(inputField)
-			return nil
+		explorer.SetInputCapture(func(ev *tcell.EventKey) *tcell.EventKey {
+			if ev.Key() == tcell.KeyTab {
+				app.SetFocus(outputView)
+				return nil
+			}
+			return ev
+		})
+		outputView.SetInputCapture(func(ev *tcell.EventKey) *tcell.EventKey {
+			switch ev.Key() {
+			case tcell.KeyTab:
+				// From output -> input
+				app.SetFocus(inputField)
+				return nil
+			case tcell.KeyBacktab:
+				// If you want Shift+Tab to also go to input
+				app.SetFocus(inputField)
+				return nil
+			}
+			return ev
+		})
+
+		// Your existing bordered "terminal" area.
+		terminal.
+			SetDirection(tview.FlexRow).
+			SetBorder(true)
+		terminal.
+			AddItem(graph, 0, 0, false).    // shown once a range query is graphed
+			AddItem(results, 0, 0, false).  // shown once an instant query returns samples
+			AddItem(explorer, 0, 0, false). // shown by the explore command
+			AddItem(outputView, 0, 1, true).
+			AddItem(inputField, 2, 0, true) // parse errors above the query
+
+		tab.terminal, tab.output, tab.input = terminal, outputView, inputField
+		return tab
+	}
+
+	switchTab = func(i int) {
+		active = i
+		tabPages.SwitchToPage(strconv.Itoa(tabs[i].id))
+		UpdateMiddleCol(middleTable, tabs[i].status)
+		renderTabs(tabBar, tabs, active)
+		app.SetFocus(tabs[i].input)
+	}
+	openTab = func(status TerminalStatus) *queryTab {
+		tab := newTab(status)
+		tabs = append(tabs, tab)
+		tabPages.AddPage(strconv.Itoa(tab.id), tab.terminal, true, false)
+		switchTab(len(tabs) - 1)
+		return tab
+	}
+	closeTab = func(i int) {
+		if len(tabs) == 1 {
+			tabs[i].output.Write([]byte("\n[green] last tab, exit closes the query view\n"))
+			return
 		}
-		return ev
-	})
-	// Your existing bordered "terminal" area.
-	terminal := tview.NewFlex()
-	terminal.
-		SetDirection(tview.FlexRow).
-		SetBorder(true)
-	terminal.
-		AddItem(outputView, 0, 1, true).
-		AddItem(inputField, 1, 0, true)
+		tabPages.RemovePage(strconv.Itoa(tabs[i].id))
+		tabs = slices.Delete(tabs, i, i+1)
+		switchTab(min(i, len(tabs)-1))
+	}
+
+	first := openTab(status)
+	first.output.Write([]byte(fmt.Sprintf("[grey]%s\n", tview.Escape(report.Summary(20)))))
+	if len(notAligned) > 0 {
+		first.output.Write([]byte(fmt.Sprintf("[red]%s not found in %s, left unaligned\n",
+			opts.AlignMetric, strings.Join(notAligned, ", "))))
+	}
+	applyInitialQuery(first.status, opts.Initial, ts.Head().MinTime(), ts.Head().MaxTime(), first.output)
+	UpdateMiddleCol(middleTable, first.status)
+
+	jobName := files[0].Name
+	if len(files) > 1 {
+		jobName = fmt.Sprintf("%d jobs (%s)", len(files), strings.Join(jobs, ", "))
+	}
+	if opts.Align {
+		jobName += " [green](aligned)"
+	}
 
-		// --- LEFT column (your row1)
+	// --- LEFT column (your row1)
 
 	rightCol := tview.NewFlex().
 		SetDirection(tview.FlexColumn)
@@ -507,27 +1211,97 @@ func TerminalView(app *tview.Application, pages *tview.Pages, file *FileItem, on
 
 	header := tview.NewFlex().
 		SetDirection(tview.FlexColumn).
-		AddItem(BuildLeftCol(ts.DB, file.Context, file.Name, file.Date), 0, 25, false).
+		AddItem(BuildLeftCol(ts.DB, files[0].Context, jobName, date), 0, 25, false).
 		AddItem(middleFlex, 0, 25, false).
 		AddItem(BuildCommandsCol(), 0, 27, false).
 		AddItem(rightCol, 0, 20, true)
 
 	root := tview.NewFlex().
 		SetDirection(tview.FlexRow).
-		AddItem(header, 7, 0, false). // 1 row tall header
-		AddItem(terminal, 0, 1, true) // fill the rest with the terminal
+		AddItem(header, 14, 0, false). // 1 row tall header
+		AddItem(tabBar, 1, 0, false).
+		AddItem(tabPages, 0, 1, true) // fill the rest with the active tab
 
 	pages.AddAndSwitchToPage("terminal", root, true)
-	app.SetFocus(inputField)
+	app.SetFocus(first.input)
 
 	app.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
-		if event.Key() == tcell.KeyEscape {
+		switch event.Key() {
+		case tcell.KeyEscape:
+			return nil
+		case tcell.KeyCtrlT:
+			// New tab with the mode and times of the active one
+			openTab(*tabs[active].status)
+			return nil
+		case tcell.KeyCtrlN:
+			switchTab((active + 1) % len(tabs))
 			return nil
+		case tcell.KeyCtrlP:
+			switchTab((active + len(tabs) - 1) % len(tabs))
+			return nil
+		case tcell.KeyCtrlD:
+			// Closes the tab on an empty input line, like a shell
+			if input := tabs[active].input; app.GetFocus() == input && input.GetText() == "" {
+				closeTab(active)
+				return nil
+			}
 		}
 		return event
 	})
 }
 
+// renderTabs draws the tab bar, each tab named by its last query or its
+// mode, the active one highlighted.
+func renderTabs(bar *tview.TextView, tabs []*queryTab, active int) {
+	var sb strings.Builder
+	for i, tab := range tabs {
+		name := tab.status.queryMode
+		if tab.last != "" {
+			name = tab.last
+			if runes := []rune(name); len(runes) > 24 {
+				name = string(runes[:23]) + "…"
+			}
+		}
+		if i == active {
+			fmt.Fprintf(&sb, "[black:orange] %d %s [-:-] ", i+1, tview.Escape(name))
+		} else {
+			fmt.Fprintf(&sb, "[grey] %d %s [-] ", i+1, tview.Escape(name))
+		}
+	}
+	sb.WriteString("[grey] ctrl-t new, ctrl-n/ctrl-p switch, ctrl-d on an empty line closes")
+	bar.SetText(sb.String())
+}
+
+// applyInitialQuery sets the command line mode and times on status, the end
+// first so the start and time can refer to it. Invalid times are reported on
+// output and leave the defaults.
+func applyInitialQuery(status *TerminalStatus, initial InitialQuery, minTime, maxTime int64, output io.Writer) {
+	if initial.Mode != "" {
+		status.queryMode = initial.Mode
+	}
+	if initial.Step > 0 {
+		status.interval = initial.Step
+	}
+	for _, t := range []struct {
+		expr string
+		dst  *time.Time
+	}{
+		{initial.End, &status.intervalEnd},
+		{initial.Start, &status.intervalStart},
+		{initial.Time, &status.instantTime},
+	} {
+		if t.expr == "" {
+			continue
+		}
+		v, err := ParseTime(t.expr, SessionAnchors(status, minTime, maxTime))
+		if err != nil {
+			fmt.Fprintf(output, "[red]%s\n", tview.Escape(err.Error()))
+			continue
+		}
+		*t.dst = v
+	}
+}
+
 func ProcessCommand(stdin string, db *tsdb.DB, status *TerminalStatus, outputView *tview.TextView) string {
 	parts := strings.Fields(stdin)
 	if len(parts) == 0 {
@@ -554,34 +1328,60 @@ func ProcessCommand(stdin string, db *tsdb.DB, status *TerminalStatus, outputVie
 
 	case "lookback":
 		if len(parts) == 2 {
-			if newLookback, err := strconv.Atoi(parts[1]); err == nil {
-				status.lookbackDelta = time.Duration(newLookback) * time.Second
-				return "lookback " + parts[1]
+			d, err := ParseDuration(parts[1])
+			if err != nil || d <= 0 {
+				return "failed to parse duration"
 			}
-			return "failed to parse number"
+			status.lookbackDelta = d
+			return "lookback " + d.String()
+		}
+		return "invalid number of arguments"
+
+	case "limit":
+		if len(parts) == 3 {
+			if parts[1] == "timeout" {
+				d, err := ParseDuration(parts[2])
+				if err != nil || d <= 0 {
+					return "failed to parse duration"
+				}
+				status.timeout = d
+				return "limit timeout " + d.String()
+			}
+			val, err := strconv.Atoi(parts[2])
+			if err != nil || val <= 0 {
+				return "failed to parse number"
+			}
+			switch parts[1] {
+			case "samples":
+				status.maxSamples = val
+			case "concurrency":
+				status.concurrency = val
+			default:
+				return "invalid argument"
+			}
+			return "limit " + parts[1] + " " + parts[2]
 		}
 		return "invalid number of arguments"
 
 	case "interval":
 		if len(parts) == 3 && (parts[1] == "start" || parts[1] == "end") {
-			val, err := strconv.ParseInt(parts[2], 10, 64)
+			t, err := ParseTime(parts[2], SessionAnchors(status, db.Head().MinTime(), db.Head().MaxTime()))
 			if err != nil {
-				return "invalid number of arguments"
+				return err.Error()
 			}
 			if parts[1] == "start" {
-				status.intervalStart = time.UnixMilli(val)
-				return "interval start " + parts[2]
+				status.intervalStart = t
+				return "interval start " + t.Format(time.RFC3339)
 			}
-			status.intervalEnd = time.UnixMilli(val)
-			return "interval end " + parts[2]
+			status.intervalEnd = t
+			return "interval end " + t.Format(time.RFC3339)
 		} else if len(parts) == 2 {
-
-			val, err := strconv.ParseInt(parts[1], 10, 64)
-			if err != nil {
-				return "invalid number of arguments"
+			d, err := ParseDuration(parts[1])
+			if err != nil || d <= 0 {
+				return "failed to parse duration"
 			}
-			status.interval = time.Second * time.Duration(val)
-			return "interval " + parts[1]
+			status.interval = d
+			return "interval " + d.String()
 		}
 
 		return "invalid arguments"
@@ -595,7 +1395,7 @@ func ProcessCommand(stdin string, db *tsdb.DB, status *TerminalStatus, outputVie
 				matcher = parts[1]
 			}
 
-			metrics := GetMetricNames(*db, matcher)
+			metrics := GetMetricNames(db, matcher)
 			outputView.Write([]byte("\n"))
 			for _, m := range metrics {
 				outputView.Write([]byte(fmt.Sprintf("[green] %s\n", m)))
@@ -604,14 +1404,80 @@ func ProcessCommand(stdin string, db *tsdb.DB, status *TerminalStatus, outputVie
 			return "metrics"
 		}
 		return "invalid number of arguments"
+	case "graph":
+		if len(parts) == 1 {
+			status.graph = !status.graph
+			if status.graph {
+				return "graph on"
+			}
+			return "graph off"
+		}
+		return "invalid number of arguments"
+
+	case "table":
+		if len(parts) == 1 {
+			status.table = !status.table
+			if status.table {
+				return "table on"
+			}
+			return "table off"
+		}
+		return "invalid number of arguments"
+
+	case "stats":
+		// Handled by the query view, which has the job files
+		switch len(parts) {
+		case 1:
+			return fmt.Sprintf("stats %d", DefaultStatsTop)
+		case 2:
+			if n, err := strconv.Atoi(parts[1]); err == nil && n > 0 {
+				return "stats " + parts[1]
+			}
+			return "failed to parse number"
+		}
+		return "invalid number of arguments"
+
+	case "explore":
+		// Handled by the query view, which owns the explorer pane
+		switch len(parts) {
+		case 1:
+			return "explore"
+		case 2:
+			return "explore " + parts[1]
+		}
+		return "invalid number of arguments"
+
+	case "tab":
+		// Handled by the query view, which owns the tabs
+		if len(parts) == 2 {
+			if parts[1] == "new" || parts[1] == "close" {
+				return "tab " + parts[1]
+			}
+			if n, err := strconv.Atoi(parts[1]); err == nil {
+				return "tab " + strconv.Itoa(n)
+			}
+			return "invalid argument"
+		}
+		return "invalid number of arguments"
+
+	case "fit":
+		if len(parts) == 1 {
+			if !FitRange(status, db.Head().MinTime(), db.Head().MaxTime()) {
+				return "no data to fit"
+			}
+			return fmt.Sprintf("fit %s to %s, interval %s",
+				status.intervalStart.Format(time.RFC3339), status.intervalEnd.Format(time.RFC3339), status.interval)
+		}
+		return "invalid number of arguments"
+
 	case "time":
 		if len(parts) == 2 {
-			val, err := strconv.ParseInt(parts[1], 10, 64)
+			t, err := ParseTime(parts[1], SessionAnchors(status, db.Head().MinTime(), db.Head().MaxTime()))
 			if err != nil {
-				return "failed to parse time"
+				return err.Error()
 			}
-			status.instantTime = time.UnixMilli(val)
-			return "time " + parts[1]
+			status.instantTime = t
+			return "time " + t.Format(time.RFC3339)
 		}
 	}
 